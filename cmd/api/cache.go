@@ -0,0 +1,90 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// responseCache keeps computed responses in memory for a short while, it
+// is meant for expensive reads that can be slightly stale. It holds at most
+// maxEntries, the oldest entry makes room for a new one once it's full.
+type responseCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+
+	// order lists the entries from the oldest to the most recently set,
+	// every entry lives as long as the TTL so it's also their expiry order
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key     string
+	value   any
+	expires time.Time
+}
+
+func newResponseCache(ttl time.Duration, maxEntries int) *responseCache {
+	return &responseCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value cached under key, if it hasn't expired yet
+func (c *responseCache) Get(key string) (any, bool) {
+	if c == nil || c.ttl <= 0 || c.maxEntries <= 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		return nil, false
+	}
+
+	return entry.value, true
+}
+
+// Set caches the value under key. The expired entries at the front of the
+// order are dropped on the way, each entry is dropped once so a Set costs
+// a constant time on average.
+func (c *responseCache) Set(key string, value any) {
+	if c == nil || c.ttl <= 0 || c.maxEntries <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for front := c.order.Front(); front != nil && now.After(front.Value.(*cacheEntry).expires); front = c.order.Front() {
+		c.remove(front)
+	}
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	for c.order.Len() >= c.maxEntries {
+		c.remove(c.order.Front())
+	}
+
+	c.entries[key] = c.order.PushBack(&cacheEntry{key: key, value: value, expires: now.Add(c.ttl)})
+}
+
+func (c *responseCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).key)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResponseCache(t *testing.T) {
+	cache := newResponseCache(time.Minute, 2)
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+
+	if value, ok := cache.Get("a"); !ok || value != 1 {
+		t.Errorf("got %v, %v, want 1", value, ok)
+	}
+
+	// a full cache makes room by dropping its oldest entry
+	cache.Set("c", 3)
+	if _, ok := cache.Get("a"); ok {
+		t.Error("the oldest entry should have been evicted")
+	}
+
+	if len(cache.entries) != 2 || cache.order.Len() != 2 {
+		t.Errorf("got %d entries, want 2", len(cache.entries))
+	}
+
+	// setting a key again renews it
+	cache.Set("b", 4)
+	cache.Set("d", 5)
+	if value, ok := cache.Get("b"); !ok || value != 4 {
+		t.Errorf("got %v, %v, want 4", value, ok)
+	}
+
+	if _, ok := cache.Get("c"); ok {
+		t.Error("c is the oldest entry once b is renewed")
+	}
+}
+
+func TestResponseCacheExpiry(t *testing.T) {
+	cache := newResponseCache(time.Minute, 10)
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+
+	cache.entries["a"].Value.(*cacheEntry).expires = time.Now().Add(-time.Second)
+	if _, ok := cache.Get("a"); ok {
+		t.Error("expired entries must not be returned")
+	}
+
+	cache.Set("c", 3)
+	if _, ok := cache.entries["a"]; ok {
+		t.Error("expired entries should be dropped when setting")
+	}
+
+	if _, ok := cache.Get("b"); !ok {
+		t.Error("entries that haven't expired should be kept")
+	}
+
+	var disabled *responseCache
+	disabled.Set("a", 1)
+	if _, ok := disabled.Get("a"); ok {
+		t.Error("a nil cache caches nothing")
+	}
+}
@@ -10,7 +10,10 @@ import (
 type contextKey string
 
 const (
-	userCtxKey = contextKey("user")
+	userCtxKey    = contextKey("user")
+	sessionCtxKey = contextKey("session")
+
+	permissionsCtxKey = contextKey("permissions")
 )
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
@@ -26,3 +29,27 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 
 	return user
 }
+
+func (app *application) contextSetSession(r *http.Request, session *data.Session) *http.Request {
+	ctx := context.WithValue(r.Context(), sessionCtxKey, session)
+	return r.WithContext(ctx)
+}
+
+// contextGetSession returns the session of the authentication token the
+// request was made with, it's nil for anonymous requests
+func (app *application) contextGetSession(r *http.Request) *data.Session {
+	session, _ := r.Context().Value(sessionCtxKey).(*data.Session)
+	return session
+}
+
+func (app *application) contextSetPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsCtxKey, permissions)
+	return r.WithContext(ctx)
+}
+
+// contextGetPermissions returns the permissions carried by a signed
+// token, ok is false when they have to be loaded
+func (app *application) contextGetPermissions(r *http.Request) (data.Permissions, bool) {
+	permissions, ok := r.Context().Value(permissionsCtxKey).(data.Permissions)
+	return permissions, ok
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yousifsabah0/blackbox/internal/data"
+)
+
+// movieETag returns the strong entity tag of a movie response. The body
+// carries reviews, images and credits that change without the movie's
+// version, so the tag is the version followed by a digest of the body.
+func movieETag(movie *data.Movie) (string, error) {
+	body, err := json.Marshal(envelope{"movie": movie})
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256(body)
+
+	return fmt.Sprintf(`"%d-%s"`, movie.Version, hex.EncodeToString(digest[:8])), nil
+}
+
+// matchVersionETag reports whether an If-Match header lists a tag of the
+// movie at the given version. Edits only change the version, so the
+// digest is left out: a review posted since the client fetched the movie
+// doesn't conflict with editing it.
+func matchVersionETag(header string, version int32) bool {
+	want := strconv.FormatInt(int64(version), 10)
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" {
+			return true
+		}
+
+		// weak tags never match, If-Match compares strongly
+		if len(candidate) < 2 || !strings.HasPrefix(candidate, `"`) || !strings.HasSuffix(candidate, `"`) {
+			continue
+		}
+
+		if tag, _, _ := strings.Cut(candidate[1:len(candidate)-1], "-"); tag == want {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchETag reports whether etag is listed in an If-Match or If-None-Match
+// header value. Weak comparison is used when weak is set, which ignores
+// the W/ prefix as If-None-Match requires.
+func matchETag(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" {
+			return true
+		}
+
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
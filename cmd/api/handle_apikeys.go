@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/yousifsabah0/blackbox/internal/data"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+func (app *application) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string     `json:"name"`
+		Permissions []string   `json:"permissions"`
+		Expiry      *time.Time `json:"expiry"`
+	}
+
+	if err := app.Bind(r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	owner, err := app.models.Permission.GetUserPermissions(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	key := &data.APIKey{
+		UserID:      user.ID,
+		Name:        input.Name,
+		Permissions: input.Permissions,
+		Expiry:      input.Expiry,
+	}
+
+	v := validator.New()
+	if data.ValidateAPIKey(v, key, owner); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.models.APIKey.New(key); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/users/me/api-keys/%d", key.ID))
+
+	if err := app.JSON(w, http.StatusCreated, envelope{"api_key": key}, headers); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleShowAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := app.models.APIKey.SelectAllForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"api_keys": keys}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ParseIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if err := app.models.APIKey.Delete(app.contextGetUser(r).ID, id); err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"message": "api key revoked"}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
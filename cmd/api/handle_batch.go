@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/yousifsabah0/blackbox/internal/data"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+const (
+	batchTransactional = "transactional"
+	batchBestEffort    = "best_effort"
+
+	batchCreate = "create"
+	batchUpdate = "update"
+	batchDelete = "delete"
+
+	maxBatchOperations = 500
+)
+
+type batchOperation struct {
+	Op      string `json:"op"`
+	ID      int64  `json:"id"`
+	Version *int32 `json:"version"`
+	Movie   struct {
+		Title   *string       `json:"title"`
+		Year    *int32        `json:"year"`
+		Runtime *data.Runtime `json:"runtime"`
+		Genres  []string      `json:"genres"`
+	} `json:"movie"`
+}
+
+type batchResult struct {
+	Index   int               `json:"index"`
+	Op      string            `json:"op"`
+	Status  int               `json:"status"`
+	ID      int64             `json:"id,omitempty"`
+	Version int32             `json:"version,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+// batchError fails a single operation of a batch with the given status
+type batchError struct {
+	status int
+	errors map[string]string
+}
+
+func (e *batchError) Error() string {
+	return fmt.Sprintf("batch operation failed with status %d", e.status)
+}
+
+func (app *application) handleBatchMovies(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Mode       string           `json:"mode"`
+		Operations []batchOperation `json:"operations"`
+	}
+
+	if err := app.Bind(r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Mode == "" {
+		input.Mode = batchTransactional
+	}
+
+	v := validator.New()
+
+	v.Check(validator.In(input.Mode, batchTransactional, batchBestEffort), "mode", "must be one of transactional or best_effort")
+	v.Check(len(input.Operations) > 0, "operations", "must contain at least 1 operation")
+	v.Check(len(input.Operations) <= maxBatchOperations, "operations", fmt.Sprintf("must not contain more than %d operations", maxBatchOperations))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	genres, err := app.models.Genre.Vocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	batch, err := app.models.Movie.Batch(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer batch.Rollback()
+
+	results := make([]batchResult, len(input.Operations))
+	failed := false
+
+	for i, op := range input.Operations {
+		result := &results[i]
+		result.Index = i
+		result.Op = op.Op
+
+		var movie *data.Movie
+
+		err := batch.Do(func() error {
+			var err error
+			movie, err = app.runBatchOperation(batch, op, genres)
+			return err
+		})
+
+		var opErr *batchError
+		switch {
+		case err == nil:
+			result.ID = movie.ID
+			result.Version = movie.Version
+			result.Status = http.StatusOK
+			if op.Op == batchCreate {
+				result.Status = http.StatusCreated
+			}
+		case errors.As(err, &opErr):
+			result.Status = opErr.status
+			result.Errors = opErr.errors
+			failed = true
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if failed && input.Mode == batchTransactional {
+		if err := batch.Rollback(); err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// nothing was kept, the operations that went through are reported
+		// as depending on the ones that failed
+		for i := range results {
+			if results[i].Errors == nil {
+				results[i] = batchResult{Index: i, Op: results[i].Op, Status: http.StatusFailedDependency}
+			}
+		}
+
+		if err := app.JSON(w, http.StatusUnprocessableEntity, envelope{"committed": false, "results": results}); err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := batch.Commit(); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"committed": true, "results": results}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runBatchOperation applies a single operation of a batch, operations that
+// can't be applied return a *batchError
+func (app *application) runBatchOperation(batch *data.MovieBatch, op batchOperation, genres data.Vocabulary) (*data.Movie, error) {
+	v := validator.New()
+
+	if op.Op == batchCreate {
+		movie := &data.Movie{Genres: op.Movie.Genres}
+
+		if op.Movie.Title != nil {
+			movie.Title = *op.Movie.Title
+		}
+
+		if op.Movie.Year != nil {
+			movie.Year = *op.Movie.Year
+		}
+
+		if op.Movie.Runtime != nil {
+			movie.Runtime = *op.Movie.Runtime
+		}
+
+		if data.ValidateMovie(v, movie, genres); !v.Valid() {
+			return nil, &batchError{status: http.StatusUnprocessableEntity, errors: v.Errors}
+		}
+
+		return movie, batch.Insert(movie)
+	}
+
+	if !validator.In(op.Op, batchUpdate, batchDelete) {
+		v.AddErrors("op", "must be one of create, update or delete")
+		return nil, &batchError{status: http.StatusUnprocessableEntity, errors: v.Errors}
+	}
+
+	// updates and deletes only apply to the version the client last saw
+	if op.Version == nil {
+		v.AddErrors("version", "must be provided")
+		return nil, &batchError{status: http.StatusUnprocessableEntity, errors: v.Errors}
+	}
+
+	movie, err := batch.Select(op.ID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, &batchError{status: http.StatusNotFound, errors: map[string]string{"id": "no matching movie found"}}
+		}
+
+		return nil, err
+	}
+
+	if *op.Version != movie.Version {
+		message := fmt.Sprintf("expected version %d but the movie is at version %d", *op.Version, movie.Version)
+		return nil, &batchError{status: http.StatusConflict, errors: map[string]string{"version": message}}
+	}
+
+	if op.Op == batchDelete {
+		return movie, batchConflict(batch.Delete(movie.ID, movie.Version))
+	}
+
+	if op.Movie.Title != nil {
+		movie.Title = *op.Movie.Title
+	}
+
+	if op.Movie.Year != nil {
+		movie.Year = *op.Movie.Year
+	}
+
+	if op.Movie.Runtime != nil {
+		movie.Runtime = *op.Movie.Runtime
+	}
+
+	if op.Movie.Genres != nil {
+		movie.Genres = op.Movie.Genres
+	}
+
+	if data.ValidateMovie(v, movie, genres); !v.Valid() {
+		return nil, &batchError{status: http.StatusUnprocessableEntity, errors: v.Errors}
+	}
+
+	return movie, batchConflict(batch.Update(movie))
+}
+
+func batchConflict(err error) error {
+	if errors.Is(err, data.ErrEditConflict) {
+		return &batchError{status: http.StatusConflict, errors: map[string]string{"version": "unable to update the record due to an edit conflict, please try again"}}
+	}
+
+	return err
+}
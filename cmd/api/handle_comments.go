@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/yousifsabah0/blackbox/internal/data"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+func (app *application) handleCreateComment(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ParseIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movie.Select(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		ParentID *int64 `json:"parent_id"`
+		Body     string `json:"body"`
+	}
+
+	if err := app.Bind(r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	comment := &data.Comment{
+		MovieID:  movie.ID,
+		UserID:   app.contextGetUser(r).ID,
+		ParentID: input.ParentID,
+		Body:     input.Body,
+	}
+
+	v := validator.New()
+	data.ValidateComment(v, comment)
+
+	if input.ParentID != nil {
+		parent, err := app.models.Comment.Select(movie.ID, *input.ParentID)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddErrors("parent_id", "no matching comment found on this movie")
+		case err != nil:
+			app.serverErrorResponse(w, r, err)
+			return
+		default:
+			v.Check(!parent.Deleted && !parent.Hidden, "parent_id", "can't reply to a deleted or hidden comment")
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.models.Comment.Insert(comment); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/movies/%d/comments/%d", movie.ID, comment.ID))
+
+	if err := app.JSON(w, http.StatusCreated, envelope{"comment": comment}, headers); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleShowAllComments(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ParseIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movie.Select(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.showThread(w, r, movie.ID, 0)
+}
+
+func (app *application) handleShowCommentReplies(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.readComment(w, r)
+	if !ok {
+		return
+	}
+
+	app.showThread(w, r, comment.MovieID, comment.ID)
+}
+
+// showThread writes a page of the replies to the parent comment, or of
+// the top level comments of the movie when parentID is 0
+func (app *application) showThread(w http.ResponseWriter, r *http.Request, movieID, parentID int64) {
+	var filters data.Filters
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filters.Keyset = true
+	filters.Cursor = qs.Get("cursor")
+	filters.PageSize = app.ReadInt(qs, "limit", 20, v)
+
+	filters.Sort = app.ReadString(qs, "sort", "id")
+	filters.SortSafeList = []string{"id", "-id"}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	comments, metadata, err := app.models.Comment.SelectThread(movieID, parentID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"comments": comments, "metadata": metadata}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleShowComment(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.readComment(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"comment": comment}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleUpdateComment(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.readComment(w, r)
+	if !ok {
+		return
+	}
+
+	if comment.UserID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if comment.Deleted {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Body *string `json:"body"`
+	}
+
+	if err := app.Bind(r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(!comment.Hidden, "comment", "hidden comments can't be edited")
+
+	if input.Body != nil {
+		comment.Body = *input.Body
+	}
+
+	if data.ValidateComment(v, comment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.models.Comment.Update(comment); err != nil {
+		if errors.Is(err, data.ErrEditConflict) {
+			app.editConflictResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"comment": comment}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleDeleteComment(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.readComment(w, r)
+	if !ok {
+		return
+	}
+
+	if comment.UserID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if err := app.models.Comment.Delete(comment.ID); err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"message": "deleted"}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleHideComment(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.readComment(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Hidden *bool `json:"hidden"`
+	}
+
+	if err := app.Bind(r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.Hidden != nil, "hidden", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.models.Comment.SetHidden(comment, *input.Hidden, app.contextGetUser(r).ID); err != nil {
+		if errors.Is(err, data.ErrEditConflict) {
+			app.editConflictResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"comment": comment}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readComment loads the comment named by the route, it writes the error
+// response itself and reports whether the handler can go on
+func (app *application) readComment(w http.ResponseWriter, r *http.Request) (*data.Comment, bool) {
+	id, err := app.ParseIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	commentID, err := app.ParseNamedIDParams(r, "comment_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	comment, err := app.models.Comment.Select(id, commentID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return nil, false
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	return comment, true
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/yousifsabah0/blackbox/internal/data"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+func (app *application) handleShowAllGenres(w http.ResponseWriter, r *http.Request) {
+	genres, err := app.models.Genre.SelectAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"genres": genres}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleShowGenre(w http.ResponseWriter, r *http.Request) {
+	genre, ok := app.readGenre(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"genre": genre}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleCreateGenre(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name    string   `json:"name"`
+		Slug    string   `json:"slug"`
+		Aliases []string `json:"aliases"`
+	}
+
+	if err := app.Bind(r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	genre := &data.Genre{
+		Name:    strings.TrimSpace(input.Name),
+		Slug:    input.Slug,
+		Aliases: input.Aliases,
+	}
+
+	if genre.Slug == "" {
+		genre.Slug = data.Slugify(genre.Name)
+	}
+
+	if genre.Aliases == nil {
+		genre.Aliases = []string{}
+	}
+
+	vocabulary, err := app.models.Genre.Vocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateGenre(v, genre)
+	checkGenreSpellings(v, vocabulary, "", "name", genre.Name, genre.Slug)
+	for _, alias := range genre.Aliases {
+		checkGenreSpellings(v, vocabulary, "", "aliases", alias)
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.models.Genre.Insert(genre); err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGenre):
+			v.AddErrors("slug", "a genre with this slug already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateAlias):
+			v.AddErrors("aliases", "alias is already in use")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/genres/%d", genre.ID))
+
+	if err := app.JSON(w, http.StatusCreated, envelope{"genre": genre}, headers); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleRenameGenre(w http.ResponseWriter, r *http.Request) {
+	genre, ok := app.readGenre(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name *string `json:"name"`
+		Slug *string `json:"slug"`
+	}
+
+	if err := app.Bind(r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	oldSlug := genre.Slug
+
+	if input.Name != nil {
+		genre.Name = strings.TrimSpace(*input.Name)
+	}
+
+	if input.Slug != nil {
+		genre.Slug = *input.Slug
+	}
+
+	vocabulary, err := app.models.Genre.Vocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateGenre(v, genre)
+	checkGenreSpellings(v, vocabulary, oldSlug, "name", genre.Name, genre.Slug)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.models.Genre.Rename(genre, oldSlug, app.contextGetUser(r).ID); err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGenre):
+			v.AddErrors("slug", "a genre with this slug already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateAlias):
+			v.AddErrors("slug", "slug is an alias of another genre")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	genre, err = app.models.Genre.Select(genre.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"genre": genre}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleAddGenreAlias(w http.ResponseWriter, r *http.Request) {
+	genre, ok := app.readGenre(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Alias string `json:"alias"`
+	}
+
+	if err := app.Bind(r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	alias := strings.TrimSpace(input.Alias)
+
+	vocabulary, err := app.models.Genre.Vocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(alias != "", "alias", "must be provided")
+	v.Check(len(alias) <= 100, "alias", "must not be more than 100 bytes long")
+	if slug, ok := vocabulary.Normalize(alias); ok {
+		v.AddErrors("alias", fmt.Sprintf("already refers to genre %q", slug))
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.models.Genre.AddAlias(genre.ID, alias); err != nil {
+		if errors.Is(err, data.ErrDuplicateAlias) {
+			v.AddErrors("alias", "alias is already in use")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	genre, err = app.models.Genre.Select(genre.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusCreated, envelope{"genre": genre}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleMergeGenre(w http.ResponseWriter, r *http.Request) {
+	source, ok := app.readGenre(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Into int64 `json:"into"`
+	}
+
+	if err := app.Bind(r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(input.Into != source.ID, "into", "can't merge a genre into itself"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	target, err := app.models.Genre.Select(input.Into)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddErrors("into", "no matching genre found")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.models.Genre.Merge(source, target, app.contextGetUser(r).ID); err != nil {
+		if errors.Is(err, data.ErrEditConflict) {
+			app.editConflictResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	target, err = app.models.Genre.Select(target.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"genre": target}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readGenre loads the genre named by the :id parameter, writing the error
+// response itself when it can't
+func (app *application) readGenre(w http.ResponseWriter, r *http.Request) (*data.Genre, bool) {
+	id, err := app.ParseIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	genre, err := app.models.Genre.Select(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return nil, false
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	return genre, true
+}
+
+// checkGenreSpellings reports the spellings that already refer to a genre
+// other than owner, the slug of the genre being edited
+func checkGenreSpellings(v *validator.Validator, vocabulary data.Vocabulary, owner, key string, spellings ...string) {
+	for _, spelling := range spellings {
+		if slug, ok := vocabulary.Normalize(spelling); ok && slug != owner {
+			v.AddErrors(key, fmt.Sprintf("%q already refers to genre %q", spelling, slug))
+		}
+	}
+}
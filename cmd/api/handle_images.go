@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/yousifsabah0/blackbox/internal/data"
+	"github.com/yousifsabah0/blackbox/internal/images"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+func (app *application) handleUploadMovieImage(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ParseIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movie.Select(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.images.maxBytes)
+
+	if err := r.ParseMultipartForm(uploadMemoryBytes); err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.badRequestResponse(w, r, fmt.Errorf("upload must not be larger than %d bytes", app.config.images.maxBytes))
+			return
+		}
+
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	image := &data.Image{
+		MovieID: movie.ID,
+		Kind:    r.FormValue("kind"),
+	}
+
+	v := validator.New()
+	data.ValidateImage(v, image)
+
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) {
+			v.AddErrors("image", "must be provided")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	body, err := io.ReadAll(file)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	upload := images.Inspect(v, body, header.Header.Get("Content-Type"))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	variants, err := images.Generate(upload)
+	if err != nil {
+		v.AddErrors("image", "could not be decoded")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	variants[images.VariantOriginal] = upload.Body
+
+	image.Format = upload.Format
+	image.Width = upload.Width
+	image.Height = upload.Height
+
+	if err := app.models.Image.Insert(image); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, name := range images.VariantNames() {
+		if err := app.storage.Put(r.Context(), image.Key(name), bytes.NewReader(variants[name])); err != nil {
+			app.deleteImageFiles(context.WithoutCancel(r.Context()), image)
+
+			if err := app.models.Image.Delete(image.MovieID, image.ID); err != nil {
+				app.logError(r, err)
+			}
+
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.setImageURLs(image)
+
+	headers := make(http.Header)
+	headers.Set("Location", image.URLs[images.VariantOriginal])
+
+	if err := app.JSON(w, http.StatusCreated, envelope{"image": image}, headers); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleShowMovieImages(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ParseIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movie.Select(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.attachImages(movie); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"images": movie.Images}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleDeleteMovieImage(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.ParseIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	id, err := app.ParseNamedIDParams(r, "image_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	image, err := app.models.Image.Select(movieID, id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.models.Image.Delete(image.MovieID, image.ID); err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.deleteImageFiles(context.WithoutCancel(r.Context()), image)
+
+	if err := app.JSON(w, http.StatusOK, envelope{"message": "deleted"}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// attachImages loads the images of the movies and fills in their URLs
+func (app *application) attachImages(movies ...*data.Movie) error {
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+
+	found, err := app.models.Image.SelectForMovies(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, movie := range movies {
+		movie.Images = found[movie.ID]
+		if movie.Images == nil {
+			movie.Images = []*data.Image{}
+		}
+
+		for _, image := range movie.Images {
+			app.setImageURLs(image)
+		}
+	}
+
+	return nil
+}
+
+func (app *application) setImageURLs(image *data.Image) {
+	image.URLs = make(map[string]string)
+	for _, name := range images.VariantNames() {
+		image.URLs[name] = app.storage.URL(image.Key(name))
+	}
+}
+
+// deleteImageFiles removes every variant of the images from storage,
+// failures are only logged as the images are gone either way. Requests
+// pass a context that isn't cancelled with them, so the files are removed
+// even if the client goes away.
+func (app *application) deleteImageFiles(ctx context.Context, imgs ...*data.Image) {
+	for _, image := range imgs {
+		for _, name := range images.VariantNames() {
+			if err := app.storage.Delete(ctx, image.Key(name)); err != nil {
+				app.logger.Error(err, map[string]string{"key": image.Key(name)})
+			}
+		}
+	}
+}
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/yousifsabah0/blackbox/internal/catalog"
 	"github.com/yousifsabah0/blackbox/internal/data"
+	"github.com/yousifsabah0/blackbox/internal/patch"
 	"github.com/yousifsabah0/blackbox/internal/validator"
 )
 
@@ -29,19 +37,37 @@ func (app *application) handleCreateMovie(w http.ResponseWriter, r *http.Request
 		Genres:  input.Genres,
 	}
 
+	genres, err := app.models.Genre.Vocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	v := validator.New()
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	if data.ValidateMovie(v, movie, genres); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	if err := app.models.Movie.Insert(movie); err != nil {
+	if err := app.models.Movie.Insert(movie, app.contextGetUser(r).ID); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.displayGenres(movie); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	etag, err := movieETag(movie)
+	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	headers.Set("ETag", etag)
 
 	if err := app.JSON(w, http.StatusCreated, envelope{"movie": movie}, headers); err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -50,37 +76,154 @@ func (app *application) handleCreateMovie(w http.ResponseWriter, r *http.Request
 
 func (app *application) handleShowAllMovies(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title  string
-		Genres []string
+		data.MovieSearch
 		data.Filters
+		data.Projection
+		Facets []string
 	}
 
 	v := validator.New()
 	qs := r.URL.Query()
 
-	input.Title = app.ReadString(qs, "title", "")
-	input.Genres = app.ReadCSV(qs, "genres", []string{})
-
-	input.Filters.Page = app.ReadInt(qs, "page", 1, v)
-	input.Filters.PageSize = app.ReadInt(qs, "page_size", 20, v)
+	input.MovieSearch = app.readMovieSearch(qs, v)
+	input.Facets = app.ReadCSV(qs, "facets", []string{})
+	input.Projection = app.readProjection(qs)
+
+	if qs.Has("cursor") {
+		input.Filters.Keyset = true
+		input.Filters.Cursor = qs.Get("cursor")
+		input.Filters.PageSize = app.ReadInt(qs, "limit", 20, v)
+	} else {
+		input.Filters.Page = app.ReadInt(qs, "page", 1, v)
+		input.Filters.PageSize = app.ReadInt(qs, "page_size", 20, v)
+	}
 
 	input.Filters.Sort = app.ReadString(qs, "sort", "id")
-	input.Filters.SortSafeList = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Filters.SortSafeList = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime", data.SortRelevance}
 
-	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+	data.ValidateFilters(v, input.Filters)
+	data.ValidateMovieSearch(v, input.MovieSearch, input.Filters)
+	data.ValidateFacets(v, input.Facets)
+	data.ValidateProjection(v, input.Projection)
+
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	movies, metadata, err := app.models.Movie.SelectMany(input.Title, input.Genres, input.Filters)
+	genres, err := app.models.Genre.Vocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	input.MovieSearch.NormalizeGenres(genres)
+
+	movies, metadata, err := app.models.Movie.SelectMany(input.MovieSearch, input.Filters, input.Projection)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	if err := app.JSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}); err != nil {
+	if err := app.attachRelations(input.Projection, movies...); err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
+
+	response := envelope{"movies": movies, "metadata": metadata}
+
+	if len(input.Facets) > 0 {
+		facets, err := app.models.Movie.Facets(input.MovieSearch, input.Facets)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		response["facets"] = facets
+	}
+
+	if err := app.JSON(w, http.StatusOK, response); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readMovieSearch reads the criteria shared by the movie listings
+func (app *application) readMovieSearch(qs url.Values, v *validator.Validator) data.MovieSearch {
+	return data.MovieSearch{
+		Title:    app.ReadString(qs, "title", ""),
+		Genres:   app.ReadCSV(qs, "genres", []string{}),
+		Language: app.ReadString(qs, "lang", ""),
+
+		YearMin:    app.ReadInt(qs, "year_min", 0, v),
+		YearMax:    app.ReadInt(qs, "year_max", 0, v),
+		RuntimeMin: app.ReadInt(qs, "runtime_min", 0, v),
+		RuntimeMax: app.ReadInt(qs, "runtime_max", 0, v),
+
+		GenresAny:     app.ReadCSV(qs, "genres_any", []string{}),
+		ExcludeGenres: app.ReadCSV(qs, "exclude_genres", []string{}),
+
+		CreatedAfter: app.ReadTime(qs, "created_after", v),
+	}
+}
+
+// readProjection reads the fields and the related data a movie response
+// should carry, the default includes are used unless include is given
+func (app *application) readProjection(qs url.Values) data.Projection {
+	projection := data.DefaultProjection()
+
+	projection.Fields = app.ReadCSV(qs, "fields", []string{})
+	if qs.Has("include") {
+		projection.Includes = app.ReadCSV(qs, "include", []string{})
+	}
+
+	return projection
+}
+
+// displayGenres replaces the genre slugs of the movies by the genres'
+// names, for responses
+func (app *application) displayGenres(movies ...*data.Movie) error {
+	names, err := app.models.Genre.Names()
+	if err != nil {
+		return err
+	}
+
+	names.Display(movies...)
+	return nil
+}
+
+// attachRelations loads the related data the projection includes, the
+// genres of the movies are named on the way
+func (app *application) attachRelations(projection data.Projection, movies ...*data.Movie) error {
+	if err := app.displayGenres(movies...); err != nil {
+		return err
+	}
+
+	if projection.Has(data.IncludeImages) {
+		if err := app.attachImages(movies...); err != nil {
+			return err
+		}
+	}
+
+	if projection.Has(data.IncludeCredits) {
+		ids := make([]int64, len(movies))
+		for i, movie := range movies {
+			ids[i] = movie.ID
+		}
+
+		credits, err := app.models.Person.CreditsForMovies(ids)
+		if err != nil {
+			return err
+		}
+
+		for _, movie := range movies {
+			movie.Credits = credits[movie.ID]
+			if movie.Credits == nil {
+				movie.Credits = []*data.CastMember{}
+			}
+		}
+	}
+
+	return nil
 }
 
 func (app *application) handleShowMovie(w http.ResponseWriter, r *http.Request) {
@@ -90,7 +233,15 @@ func (app *application) handleShowMovie(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	movie, err := app.models.Movie.Select(id)
+	projection := app.readProjection(r.URL.Query())
+
+	v := validator.New()
+	if data.ValidateProjection(v, projection); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movie.SelectProjected(id, projection)
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
 			app.notFoundResponse(w, r)
@@ -101,7 +252,29 @@ func (app *application) handleShowMovie(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := app.JSON(w, http.StatusOK, envelope{"movie": movie}); err != nil {
+	if err := app.attachRelations(projection, movie); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// the tag covers the relations, so it can only be compared once they
+	// are attached
+	etag, err := movieETag(movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && matchETag(ifNoneMatch, etag, true) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	if err := app.JSON(w, http.StatusOK, envelope{"movie": movie}, headers); err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
@@ -124,41 +297,69 @@ func (app *application) handleUpdateMovie(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	var input struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		Runtime *data.Runtime `json:"runtime"`
-		Genres  []string      `json:"genres"`
-	}
-
-	if err := app.Bind(r, &input); err != nil {
-		app.badRequestResponse(w, r, err)
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !matchVersionETag(ifMatch, movie.Version) {
+		app.preconditionFailedResponse(w, r)
 		return
 	}
 
-	if input.Title != nil {
-		movie.Title = *input.Title
-	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case patch.MergePatchContentType, patch.JSONPatchContentType:
+		if err := app.patchMovie(r, movie, mediaType); err != nil {
+			switch {
+			case errors.Is(err, patch.ErrTestFailed):
+				app.patchTestFailedResponse(w, r, err)
+			case errors.Is(err, patch.ErrInvalidPatch), errors.Is(err, errInvalidPatchedMovie):
+				app.failedValidationResponse(w, r, map[string]string{"patch": err.Error()})
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+	default:
+		var input struct {
+			Title   *string       `json:"title"`
+			Year    *int32        `json:"year"`
+			Runtime *data.Runtime `json:"runtime"`
+			Genres  []string      `json:"genres"`
+		}
 
-	if input.Year != nil {
-		movie.Year = *input.Year
-	}
+		if err := app.Bind(r, &input); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if input.Title != nil {
+			movie.Title = *input.Title
+		}
 
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
+		if input.Year != nil {
+			movie.Year = *input.Year
+		}
+
+		if input.Runtime != nil {
+			movie.Runtime = *input.Runtime
+		}
+
+		if input.Genres != nil {
+			movie.Genres = input.Genres
+		}
 	}
 
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+	genres, err := app.models.Genre.Vocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	v := validator.New()
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	if data.ValidateMovie(v, movie, genres); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	if err := app.models.Movie.Update(movie); err != nil {
+	if err := app.models.Movie.Update(movie, app.contextGetUser(r).ID); err != nil {
 		if errors.Is(err, data.ErrEditConflict) {
 			app.editConflictResponse(w, r)
 			return
@@ -168,11 +369,88 @@ func (app *application) handleUpdateMovie(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if err := app.JSON(w, http.StatusOK, envelope{"movie": movie}); err != nil {
+	// the response is the one a GET of the movie gets, so is its tag
+	if err := app.attachRelations(data.DefaultProjection(), movie); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	etag, err := movieETag(movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	if err := app.JSON(w, http.StatusOK, envelope{"movie": movie}, headers); err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// movieDocument is the part of a movie that patches are applied to
+type movieDocument struct {
+	Title   string       `json:"title"`
+	Year    int32        `json:"year"`
+	Runtime data.Runtime `json:"runtime"`
+	Genres  []string     `json:"genres"`
+}
+
+// errInvalidPatchedMovie is returned when a patch applies cleanly but
+// leaves something that isn't a movie
+var errInvalidPatchedMovie = errors.New("patched movie is invalid")
+
+// patchMovie applies the merge patch or JSON patch in the body to the
+// editable fields of the movie
+func (app *application) patchMovie(r *http.Request, movie *data.Movie, mediaType string) error {
+	doc, err := json.Marshal(movieDocument{
+		Title:   movie.Title,
+		Year:    movie.Year,
+		Runtime: movie.Runtime,
+		Genres:  movie.Genres,
+	})
+	if err != nil {
+		return err
+	}
+
+	if mediaType == patch.MergePatchContentType {
+		var changes json.RawMessage
+		if err := app.Bind(r, &changes); err != nil {
+			return err
+		}
+
+		doc, err = patch.Merge(doc, changes)
+	} else {
+		var operations []patch.Operation
+		if err := app.Bind(r, &operations); err != nil {
+			return err
+		}
+
+		doc, err = patch.Apply(doc, operations)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var patched movieDocument
+
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&patched); err != nil {
+		return fmt.Errorf("%w: %s", errInvalidPatchedMovie, err)
+	}
+
+	movie.Title = patched.Title
+	movie.Year = patched.Year
+	movie.Runtime = patched.Runtime
+	movie.Genres = patched.Genres
+
+	return nil
+}
+
 func (app *application) handleDeleteMovie(w http.ResponseWriter, r *http.Request) {
 	id, err := app.ParseIDParams(r)
 	if err != nil {
@@ -180,7 +458,33 @@ func (app *application) handleDeleteMovie(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if err := app.models.Movie.Delete(id); err != nil {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		movie, err := app.models.Movie.Select(id)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				app.notFoundResponse(w, r)
+				return
+			}
+
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !matchVersionETag(ifMatch, movie.Version) {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
+
+		if err := app.models.Movie.DeleteVersion(movie.ID, movie.Version); err != nil {
+			if errors.Is(err, data.ErrEditConflict) {
+				app.preconditionFailedResponse(w, r)
+				return
+			}
+
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	} else if err := app.models.Movie.Delete(id); err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
 			app.notFoundResponse(w, r)
 			return
@@ -193,3 +497,175 @@ func (app *application) handleDeleteMovie(w http.ResponseWriter, r *http.Request
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+func (app *application) handleImportMovies(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	defaultFormat := catalog.FormatNDJSON
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		defaultFormat = catalog.FormatCSV
+	}
+
+	format := app.ReadString(qs, "format", defaultFormat)
+	dryRun := app.ReadBool(qs, "dry_run", false, v)
+
+	if v.Check(validator.In(format, catalog.Formats...), "format", "must be one of csv or ndjson"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	reader, err := catalog.NewReader(r.Body, format)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	report, err := app.importMovies(reader, app.contextGetUser(r).ID, dryRun)
+	if err != nil {
+		if report == nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// the batches written before the error stay committed, the report
+		// tells the client which rows made it
+		status, message := http.StatusInternalServerError, "the import stopped part way, only the rows reported as created were committed"
+
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			status, message = http.StatusBadRequest, fmt.Sprintf("body must not be larger than %d bytes, only the rows reported as created were committed", maxImportBytes)
+		} else {
+			app.logError(r, err)
+		}
+
+		if err := app.JSON(w, status, envelope{"error": message, "report": report}); err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"report": report}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleExportMovies(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	search := app.readMovieSearch(qs, v)
+
+	format := app.ReadString(qs, "format", catalog.FormatNDJSON)
+
+	v.Check(validator.In(format, catalog.Formats...), "format", "must be one of csv or ndjson")
+	data.ValidateMovieSearch(v, search, data.Filters{})
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	genres, err := app.models.Genre.Vocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	search.NormalizeGenres(genres)
+
+	writer, err := catalog.NewWriter(w, format)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", catalog.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="movies-%s.%s"`, time.Now().UTC().Format("20060102"), format))
+
+	// every chunk gets a fresh write deadline so that large exports are not
+	// cut off by the server's WriteTimeout
+	written := 0
+	err = app.models.Movie.Export(r.Context(), search, func(movie *data.Movie) error {
+		if written%exportChunkSize == 0 {
+			if written > 0 {
+				if err := writer.Flush(); err != nil {
+					return err
+				}
+
+				if err := rc.Flush(); err != nil {
+					return err
+				}
+			}
+
+			if err := rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return err
+			}
+		}
+
+		written++
+		return writer.Write(movie)
+	})
+	if err != nil {
+		if written == 0 {
+			w.Header().Del("Content-Disposition")
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.logError(r, err)
+		return
+	}
+
+	if err := writer.Flush(); err != nil {
+		app.logError(r, err)
+	}
+}
+
+func (app *application) handleMovieStats(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	search := app.readMovieSearch(r.URL.Query(), v)
+
+	if data.ValidateMovieSearch(v, search, data.Filters{}); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	genres, err := app.models.Genre.Vocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	search.NormalizeGenres(genres)
+
+	// the normalized search is the cache key, so that different spellings
+	// of the same filters share their statistics
+	key, err := json.Marshal(search)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	stats, ok := app.stats.Get(string(key))
+	if !ok {
+		if stats, err = app.models.Movie.Stats(search); err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.stats.Set(string(key), stats)
+	}
+
+	headers := make(http.Header)
+	headers.Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(app.config.stats.cacheTTL.Seconds())))
+
+	if err := app.JSON(w, http.StatusOK, envelope{"stats": stats}, headers); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
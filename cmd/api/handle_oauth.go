@@ -0,0 +1,539 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/yousifsabah0/blackbox/internal/data"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+var (
+	// codeVerifierRX matches the PKCE code verifiers of RFC 7636
+	codeVerifierRX = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+)
+
+func (app *application) handleCreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Confidential bool     `json:"confidential"`
+	}
+
+	if err := app.Bind(r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	permissions, err := app.models.Permission.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	client := &data.OAuthClient{
+		UserID:       app.contextGetUser(r).ID,
+		Name:         input.Name,
+		RedirectURIs: input.RedirectURIs,
+		Scopes:       input.Scopes,
+		Confidential: input.Confidential,
+	}
+
+	v := validator.New()
+	if data.ValidateOAuthClient(v, client, permissions); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.models.OAuthClient.New(client); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/oauth/clients/%d", client.ID))
+
+	if err := app.JSON(w, http.StatusCreated, envelope{"client": client}, headers); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleShowOAuthClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := app.models.OAuthClient.SelectAllForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"clients": clients}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ParseIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if err := app.models.OAuthClient.Delete(app.contextGetUser(r).ID, id); err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"message": "client deleted"}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// authorizationRequest is what a client sends the user to the authorize
+// endpoint with, PKCE is required of every client. The frontend relays
+// the client's parameters as they were: a redirect_uri the client named
+// has to be repeated when trading the code.
+type authorizationRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+
+	// explicitRedirectURI is set when the client named the redirect uri
+	// rather than relying on the only one it registered
+	explicitRedirectURI bool
+}
+
+// handleShowAuthorization checks an authorization request and describes
+// what the user is asked to consent to
+func (app *application) handleShowAuthorization(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	req := &authorizationRequest{
+		ResponseType:        qs.Get("response_type"),
+		ClientID:            qs.Get("client_id"),
+		RedirectURI:         qs.Get("redirect_uri"),
+		Scope:               qs.Get("scope"),
+		State:               qs.Get("state"),
+		CodeChallenge:       qs.Get("code_challenge"),
+		CodeChallengeMethod: qs.Get("code_challenge_method"),
+	}
+
+	client, scopes, ok := app.readAuthorization(w, r, req)
+	if !ok {
+		return
+	}
+
+	env := envelope{"client": client, "redirect_uri": req.RedirectURI, "scopes": scopes}
+	if err := app.JSON(w, http.StatusOK, envelope{"authorization": env}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// handleAuthorize records the user's answer to an authorization request,
+// an approval is sent back to the client as a single use code
+func (app *application) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		authorizationRequest
+		Approve bool `json:"approve"`
+	}
+
+	if err := app.Bind(r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	req := &input.authorizationRequest
+
+	client, scopes, ok := app.readAuthorization(w, r, req)
+	if !ok {
+		return
+	}
+
+	if !input.Approve {
+		app.authorizationRedirect(w, r, req, url.Values{
+			"error":             {"access_denied"},
+			"error_description": {"the user denied the request"},
+		})
+		return
+	}
+
+	code := &data.OAuthCode{
+		ClientID:      client.ID,
+		UserID:        app.contextGetUser(r).ID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+
+		RedirectURIExplicit: req.explicitRedirectURI,
+	}
+
+	if err := app.models.OAuthCode.New(code); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.authorizationRedirect(w, r, req, url.Values{"code": {code.Text}})
+}
+
+// readAuthorization returns the client of an authorization request along
+// with the scopes the user can grant it. Until the redirect uri is known
+// to belong to the client, errors are answered directly, afterwards they
+// are sent back to the client through its redirect uri.
+func (app *application) readAuthorization(w http.ResponseWriter, r *http.Request, req *authorizationRequest) (*data.OAuthClient, []string, bool) {
+	if req.ClientID == "" {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", "client_id must be provided")
+		return nil, nil, false
+	}
+
+	client, err := app.models.OAuthClient.Get(req.ClientID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", "unknown client_id")
+			return nil, nil, false
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return nil, nil, false
+	}
+
+	req.explicitRedirectURI = req.RedirectURI != ""
+	if !req.explicitRedirectURI && len(client.RedirectURIs) == 1 {
+		req.RedirectURI = client.RedirectURIs[0]
+	}
+
+	if !client.AllowsRedirectURI(req.RedirectURI) {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", "redirect_uri is not registered for the client")
+		return nil, nil, false
+	}
+
+	fail := func(code, description string) {
+		app.authorizationRedirect(w, r, req, url.Values{"error": {code}, "error_description": {description}})
+	}
+
+	if req.ResponseType != "code" {
+		fail("unsupported_response_type", "response_type must be code")
+		return nil, nil, false
+	}
+
+	if req.CodeChallengeMethod != "S256" || !validCodeChallenge(req.CodeChallenge) {
+		fail("invalid_request", "a S256 code_challenge must be provided")
+		return nil, nil, false
+	}
+
+	scopes := client.Scopes
+	if req.Scope != "" {
+		scopes = strings.Fields(req.Scope)
+	}
+
+	if !validator.Unique(scopes) || !client.AllowsScopes(scopes) {
+		fail("invalid_scope", "scope must only contain the scopes registered for the client")
+		return nil, nil, false
+	}
+
+	permissions, err := app.models.Permission.GetUserPermissions(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, nil, false
+	}
+
+	granted := permissions.Narrow(scopes)
+	if len(granted) == 0 {
+		fail("invalid_scope", "the user holds none of the requested scopes")
+		return nil, nil, false
+	}
+
+	return client, granted, true
+}
+
+// authorizationRedirect answers with where the user is sent back to the
+// client. Consent is given through the API with the user's token, so it's
+// up to the frontend to follow the redirect.
+func (app *application) authorizationRedirect(w http.ResponseWriter, r *http.Request, req *authorizationRequest, params url.Values) {
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+
+	u.RawQuery = query.Encode()
+
+	if err := app.JSON(w, http.StatusOK, envelope{"redirect_to": u.String()}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// handleOAuthToken is the token endpoint of RFC 6749, it reads form
+// encoded requests and answers with bare token responses
+func (app *application) handleOAuthToken(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+
+	if err := r.ParseForm(); err != nil {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	client, ok := app.authenticateOAuthClient(w, r)
+	if !ok {
+		return
+	}
+
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case "authorization_code":
+		app.grantAuthorizationCode(w, r, client)
+	case "client_credentials":
+		app.grantClientCredentials(w, r, client)
+	case "refresh_token":
+		app.grantRefreshToken(w, r, client)
+	case "":
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", "grant_type must be provided")
+	default:
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "unsupported_grant_type", fmt.Sprintf("%q is not a supported grant_type", grantType))
+	}
+}
+
+// authenticateOAuthClient reads the client credentials from basic auth or
+// from the form. Public clients only send their client id.
+func (app *application) authenticateOAuthClient(w http.ResponseWriter, r *http.Request) (*data.OAuthClient, bool) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	if clientID == "" {
+		app.oauthErrorResponse(w, r, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return nil, false
+	}
+
+	client, err := app.models.OAuthClient.Get(clientID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.oauthErrorResponse(w, r, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+			return nil, false
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	if client.Confidential != (secret != "") || (client.Confidential && !client.MatchesSecret(secret)) {
+		app.oauthErrorResponse(w, r, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return nil, false
+	}
+
+	return client, true
+}
+
+func (app *application) grantAuthorizationCode(w http.ResponseWriter, r *http.Request, client *data.OAuthClient) {
+	form := r.PostForm
+
+	code, err := app.models.OAuthCode.Consume(form.Get("code"))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "authorization code is invalid or expired")
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if code.ClientID != client.ID {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "authorization code was issued to another client")
+		return
+	}
+
+	// RFC 6749 section 4.1.3, the redirect uri must be repeated as is when
+	// the authorization request included it
+	redirectURI := form.Get("redirect_uri")
+	if code.RedirectURIExplicit || redirectURI != "" {
+		if redirectURI != code.RedirectURI {
+			app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "redirect_uri doesn't match the one of the authorization request")
+			return
+		}
+	}
+
+	if !verifyCodeChallenge(form.Get("code_verifier"), code.CodeChallenge) {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "code_verifier doesn't match the code_challenge")
+		return
+	}
+
+	session := &data.Session{
+		UserID:    code.UserID,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		ClientID:  &client.ID,
+		Scopes:    code.Scopes,
+	}
+
+	access, refresh, err := app.models.Token.NewPair(session, app.storedAccessTTL(), app.config.auth.refreshTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.oauthTokenResponse(w, r, client, session.UserID, session.ID, session.Scopes, access, refresh)
+}
+
+// grantClientCredentials lets a confidential client act as the user who
+// registered it, without a refresh token since it can always ask again.
+// Signed access tokens don't need a session, none is started for them.
+func (app *application) grantClientCredentials(w http.ResponseWriter, r *http.Request, client *data.OAuthClient) {
+	if !client.Confidential {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "unauthorized_client", "public clients can't use the client_credentials grant")
+		return
+	}
+
+	scopes := client.Scopes
+	if scope := r.PostForm.Get("scope"); scope != "" {
+		scopes = strings.Fields(scope)
+	}
+
+	if !validator.Unique(scopes) || !client.AllowsScopes(scopes) {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_scope", "scope must only contain the scopes registered for the client")
+		return
+	}
+
+	permissions, err := app.models.Permission.GetUserPermissions(client.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	session := &data.Session{
+		UserID:    client.UserID,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		ClientID:  &client.ID,
+		Scopes:    permissions.Narrow(scopes),
+	}
+
+	if len(session.Scopes) == 0 {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_scope", "the client's owner holds none of the requested scopes")
+		return
+	}
+
+	var access *data.Token
+	if app.signer == nil {
+		if access, _, err = app.models.Token.NewPair(session, app.config.auth.accessTTL, 0); err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.oauthTokenResponse(w, r, client, session.UserID, session.ID, session.Scopes, access, nil)
+}
+
+func (app *application) grantRefreshToken(w http.ResponseWriter, r *http.Request, client *data.OAuthClient) {
+	text := r.PostForm.Get("refresh_token")
+
+	v := validator.New()
+	if data.ValidTokenText(v, text); !v.Valid() {
+		app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "refresh token is invalid or expired")
+		return
+	}
+
+	access, refresh, err := app.models.Token.Rotate(text, &client.ID, app.storedAccessTTL(), app.config.auth.refreshTTL)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTokenReused):
+			var reused *data.ReuseError
+			if errors.As(err, &reused) {
+				app.revoked.Add(reused.SessionID)
+			}
+
+			app.logger.Info("refresh token reused, token family revoked", map[string]string{
+				"remote_addr": r.RemoteAddr,
+				"client_id":   client.ClientID,
+			})
+			app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "refresh token is invalid or expired")
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "refresh token is invalid or expired")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.oauthTokenResponse(w, r, client, refresh.UserID, refresh.SessionID, refresh.Scopes, access, refresh)
+}
+
+// oauthTokenResponse answers a grant with the tokens of the session, the
+// access token is signed here when tokens are signed rather than stored
+func (app *application) oauthTokenResponse(w http.ResponseWriter, r *http.Request, client *data.OAuthClient, userID, sessionID int64, scopes []string, access, refresh *data.Token) {
+	if app.signer != nil {
+		user, err := app.models.User.Get(userID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if access, err = app.signAccessToken(user, sessionID, &client.ID, scopes); err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	env := envelope{
+		"access_token": access.Text,
+		"token_type":   "Bearer",
+		"expires_in":   int64(time.Until(access.Expiry).Round(time.Second).Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	}
+
+	if refresh != nil {
+		env["refresh_token"] = refresh.Text
+	}
+
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "no-store")
+	headers.Set("Pragma", "no-cache")
+
+	if err := app.JSON(w, http.StatusOK, env, headers); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// validCodeChallenge reports whether challenge is a base64url encoded
+// SHA-256 digest
+func validCodeChallenge(challenge string) bool {
+	digest, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(digest) == sha256.Size
+}
+
+// verifyCodeChallenge reports whether the S256 challenge was derived from
+// verifier
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if !codeVerifierRX.MatchString(verifier) {
+		return false
+	}
+
+	digest := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(digest[:])
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
@@ -0,0 +1,549 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yousifsabah0/blackbox/internal/data"
+	"github.com/yousifsabah0/blackbox/internal/jwt"
+	"github.com/yousifsabah0/blackbox/internal/logx"
+)
+
+// testDSNEnv names the database the end to end tests run against, each
+// test migrates a schema of its own and drops it afterwards
+const testDSNEnv = "BLACKBOX_TEST_DB_DSN"
+
+const (
+	testPassword    = "pa55word1234"
+	testRedirectURI = "https://app.example.com/callback"
+)
+
+// openTestDB connects to a fresh schema of the test database with every
+// migration applied
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+
+	admin, err := openDB(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+
+	schema := fmt.Sprintf("blackbox_test_%d", time.Now().UnixNano())
+
+	if _, err := admin.Exec(`CREATE EXTENSION IF NOT EXISTS citext`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		admin, err := openDB(dsn)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer admin.Close()
+
+		if _, err := admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Error(err)
+		}
+	})
+
+	// lib/pq passes unknown parameters on as run-time settings
+	separator := " "
+	if strings.Contains(dsn, "://") {
+		separator = "&"
+		if !strings.Contains(dsn, "?") {
+			separator = "?"
+		}
+	}
+
+	db, err := openDB(dsn + separator + "search_path=" + schema + ",public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob(filepath.Join("..", "..", "migrations", "*.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		up, _, _ := strings.Cut(string(content), "-- +goose Down")
+		if _, err := db.Exec(up); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(file), err)
+		}
+	}
+
+	return db
+}
+
+// newTestServer serves the routes of an application backed by the test
+// database, access tokens are signed when signer isn't nil
+func newTestServer(t *testing.T, signer *jwt.Keyring) (*application, *httptest.Server) {
+	t.Helper()
+
+	var cfg config
+	cfg.auth.accessTTL = 15 * time.Minute
+	cfg.auth.refreshTTL = 24 * time.Hour
+
+	app := &application{
+		config:  cfg,
+		logger:  logx.NewLogger(io.Discard, logx.LevelInfo),
+		models:  data.NewModel(openTestDB(t)),
+		signer:  signer,
+		revoked: newRevocations(cfg.auth.accessTTL),
+	}
+
+	ts := httptest.NewServer(app.routes())
+	t.Cleanup(func() {
+		ts.Close()
+		app.wg.Wait()
+	})
+
+	return app, ts
+}
+
+// request sends body as JSON, or as a form when it's url.Values, and
+// decodes the JSON answer
+func request(t *testing.T, ts *httptest.Server, method, path, token string, body any) (int, map[string]any) {
+	t.Helper()
+
+	var reader io.Reader
+	contentType := "application/json"
+
+	switch body := body.(type) {
+	case nil:
+	case url.Values:
+		reader = strings.NewReader(body.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	default:
+		js, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reader != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var decoded map[string]any
+	if err := json.NewDecoder(res.Body).Decode(&decoded); err != nil && err != io.EOF {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+
+	return res.StatusCode, decoded
+}
+
+// oauthFixture is an activated user logged in first party, with a public
+// and a confidential client registered
+type oauthFixture struct {
+	app *application
+	ts  *httptest.Server
+
+	user  *data.User
+	login string
+
+	public       string
+	confidential string
+	secret       string
+}
+
+func newOAuthFixture(t *testing.T, signer *jwt.Keyring) *oauthFixture {
+	t.Helper()
+
+	app, ts := newTestServer(t, signer)
+	f := &oauthFixture{app: app, ts: ts}
+
+	f.user = &data.User{Name: "Alice", Email: "alice@example.com", Activated: true}
+	if err := f.user.Password.Hash(testPassword); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.models.User.Insert(f.user); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.models.Permission.GrantUser(f.user.ID, "movies:read", "movies:write"); err != nil {
+		t.Fatal(err)
+	}
+
+	status, body := request(t, ts, http.MethodPost, "/api/v1/tokens/auth", "", map[string]string{
+		"email":    f.user.Email,
+		"password": testPassword,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("login: got %d %v", status, body)
+	}
+	f.login = body["token"].(map[string]any)["token"].(string)
+
+	f.public, _ = f.registerClient(t, false)
+	f.confidential, f.secret = f.registerClient(t, true)
+
+	return f
+}
+
+func (f *oauthFixture) registerClient(t *testing.T, confidential bool) (string, string) {
+	t.Helper()
+
+	status, body := request(t, f.ts, http.MethodPost, "/api/v1/oauth/clients", f.login, map[string]any{
+		"name":          "Example",
+		"redirect_uris": []string{testRedirectURI},
+		"scopes":        []string{"movies:read", "movies:write"},
+		"confidential":  confidential,
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("register client: got %d %v", status, body)
+	}
+
+	client := body["client"].(map[string]any)
+	secret, _ := client["client_secret"].(string)
+
+	return client["client_id"].(string), secret
+}
+
+// authorize has the user approve an authorization request of the public
+// client and returns the code, redirectURI is left out when empty
+func (f *oauthFixture) authorize(t *testing.T, verifier, redirectURI string) string {
+	t.Helper()
+
+	digest := sha256.Sum256([]byte(verifier))
+
+	status, body := request(t, f.ts, http.MethodPost, "/oauth/authorize", f.login, map[string]any{
+		"response_type":         "code",
+		"client_id":             f.public,
+		"redirect_uri":          redirectURI,
+		"scope":                 "movies:read",
+		"state":                 "xyz",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(digest[:]),
+		"code_challenge_method": "S256",
+		"approve":               true,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("authorize: got %d %v", status, body)
+	}
+
+	u, err := url.Parse(body["redirect_to"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := u.Scheme + "://" + u.Host + u.Path; got != testRedirectURI {
+		t.Fatalf("redirected to %s, want %s", got, testRedirectURI)
+	}
+
+	if state := u.Query().Get("state"); state != "xyz" {
+		t.Errorf("state: got %q, want xyz", state)
+	}
+
+	code := u.Query().Get("code")
+	if code == "" {
+		t.Fatalf("no code in %s", u)
+	}
+
+	return code
+}
+
+// token posts a token request, the confidential client authenticates with
+// basic auth
+func (f *oauthFixture) token(t *testing.T, form url.Values, confidential bool) (int, map[string]any) {
+	t.Helper()
+
+	if !confidential {
+		form.Set("client_id", f.public)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, f.ts.URL+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if confidential {
+		req.SetBasicAuth(f.confidential, f.secret)
+	}
+
+	res, err := f.ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var body map[string]any
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode == http.StatusOK && res.Header.Get("Cache-Control") != "no-store" {
+		t.Error("token responses must not be cached")
+	}
+
+	return res.StatusCode, body
+}
+
+// genres reads a movies:read guarded endpoint with token
+func (f *oauthFixture) genres(t *testing.T, token string) int {
+	t.Helper()
+
+	status, _ := request(t, f.ts, http.MethodGet, "/api/v1/genres", token, nil)
+	return status
+}
+
+func wantOAuthError(t *testing.T, status int, body map[string]any, wantStatus int, wantCode string) {
+	t.Helper()
+
+	if status != wantStatus || body["error"] != wantCode {
+		t.Errorf("got %d %v, want %d %s", status, body, wantStatus, wantCode)
+	}
+}
+
+// testSigner signs access tokens with a throwaway key
+func testSigner(t *testing.T) *jwt.Keyring {
+	t.Helper()
+
+	key, err := jwt.NewEd25519Key("test", bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ring, err := jwt.NewKeyring(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ring
+}
+
+func TestOAuth(t *testing.T) {
+	formats := map[string]func(*testing.T) *jwt.Keyring{
+		tokenFormatOpaque: func(*testing.T) *jwt.Keyring { return nil },
+		tokenFormatSigned: testSigner,
+	}
+
+	for format, signer := range formats {
+		t.Run(format, func(t *testing.T) {
+			t.Run("authorization code", func(t *testing.T) {
+				testAuthorizationCode(t, newOAuthFixture(t, signer(t)))
+			})
+
+			t.Run("client credentials", func(t *testing.T) {
+				testClientCredentials(t, newOAuthFixture(t, signer(t)))
+			})
+
+			t.Run("refresh token", func(t *testing.T) {
+				testRefreshToken(t, newOAuthFixture(t, signer(t)))
+			})
+		})
+	}
+}
+
+const (
+	testVerifier      = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r-wW1gFWFOEjXk"
+	testOtherVerifier = "3u2Fa7m3ZCpcZp6vR0qRj1xv5m0Mst8wQv7pL2t1eLk"
+)
+
+func testAuthorizationCode(t *testing.T, f *oauthFixture) {
+	exchange := func(code, verifier, redirectURI string, confidential bool) (int, map[string]any) {
+		form := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "code_verifier": {verifier}}
+		if redirectURI != "" {
+			form.Set("redirect_uri", redirectURI)
+		}
+
+		return f.token(t, form, confidential)
+	}
+
+	// a wrong verifier burns the code
+	code := f.authorize(t, testVerifier, testRedirectURI)
+
+	status, body := exchange(code, testOtherVerifier, testRedirectURI, false)
+	wantOAuthError(t, status, body, http.StatusBadRequest, "invalid_grant")
+
+	status, body = exchange(code, testVerifier, testRedirectURI, false)
+	wantOAuthError(t, status, body, http.StatusBadRequest, "invalid_grant")
+
+	// a code is only good for the client it was issued to
+	code = f.authorize(t, testVerifier, testRedirectURI)
+
+	status, body = exchange(code, testVerifier, testRedirectURI, true)
+	wantOAuthError(t, status, body, http.StatusBadRequest, "invalid_grant")
+
+	// a redirect uri named at authorization has to be repeated
+	code = f.authorize(t, testVerifier, testRedirectURI)
+
+	status, body = exchange(code, testVerifier, "", false)
+	wantOAuthError(t, status, body, http.StatusBadRequest, "invalid_grant")
+
+	code = f.authorize(t, testVerifier, testRedirectURI)
+
+	status, body = exchange(code, testVerifier, testRedirectURI+"/other", false)
+	wantOAuthError(t, status, body, http.StatusBadRequest, "invalid_grant")
+
+	// the only registered uri is implied when neither request names it
+	code = f.authorize(t, testVerifier, "")
+
+	status, body = exchange(code, testVerifier, "", false)
+	if status != http.StatusOK {
+		t.Fatalf("exchange: got %d %v", status, body)
+	}
+
+	if body["scope"] != "movies:read" || body["token_type"] != "Bearer" || body["refresh_token"] == nil {
+		t.Errorf("unexpected token response %v", body)
+	}
+
+	access := body["access_token"].(string)
+
+	if status := f.genres(t, access); status != http.StatusOK {
+		t.Errorf("genres with the granted scope: got %d", status)
+	}
+
+	status, _ = request(t, f.ts, http.MethodPost, "/api/v1/movies", access, map[string]any{"title": "Heat"})
+	if status != http.StatusForbidden {
+		t.Errorf("movie write without the scope: got %d, want 403", status)
+	}
+
+	status, _ = request(t, f.ts, http.MethodGet, "/api/v1/users/me/sessions", access, nil)
+	if status != http.StatusForbidden {
+		t.Errorf("sessions with a client's token: got %d, want 403", status)
+	}
+
+	// the code was traded already
+	status, body = exchange(code, testVerifier, "", false)
+	wantOAuthError(t, status, body, http.StatusBadRequest, "invalid_grant")
+}
+
+func testClientCredentials(t *testing.T, f *oauthFixture) {
+	form := func() url.Values {
+		return url.Values{"grant_type": {"client_credentials"}, "scope": {"movies:read"}}
+	}
+
+	status, body := f.token(t, form(), false)
+	wantOAuthError(t, status, body, http.StatusBadRequest, "unauthorized_client")
+
+	secret := f.secret
+	f.secret = secret + "x"
+
+	status, body = f.token(t, form(), true)
+	wantOAuthError(t, status, body, http.StatusUnauthorized, "invalid_client")
+
+	f.secret = secret
+
+	status, body = f.token(t, form(), true)
+	if status != http.StatusOK {
+		t.Fatalf("client credentials: got %d %v", status, body)
+	}
+
+	if _, ok := body["refresh_token"]; ok {
+		t.Error("client credentials must not issue a refresh token")
+	}
+
+	if status := f.genres(t, body["access_token"].(string)); status != http.StatusOK {
+		t.Errorf("genres: got %d", status)
+	}
+
+	var sessions int
+	if err := f.app.models.Session.DB.QueryRow(`SELECT COUNT(*) FROM sessions WHERE client_id IS NOT NULL`).Scan(&sessions); err != nil {
+		t.Fatal(err)
+	}
+
+	want := 1
+	if f.app.signer != nil {
+		want = 0
+	}
+
+	if sessions != want {
+		t.Errorf("got %d client sessions, want %d", sessions, want)
+	}
+}
+
+func testRefreshToken(t *testing.T, f *oauthFixture) {
+	code := f.authorize(t, testVerifier, testRedirectURI)
+
+	status, body := f.token(t, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"code_verifier": {testVerifier},
+		"redirect_uri":  {testRedirectURI},
+	}, false)
+	if status != http.StatusOK {
+		t.Fatalf("exchange: got %d %v", status, body)
+	}
+
+	first := body["refresh_token"].(string)
+
+	refresh := func(token string, confidential bool) (int, map[string]any) {
+		return f.token(t, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {token}}, confidential)
+	}
+
+	// only the client of the session can rotate its tokens
+	status, body = refresh(first, true)
+	wantOAuthError(t, status, body, http.StatusBadRequest, "invalid_grant")
+
+	status, body = refresh(first, false)
+	if status != http.StatusOK {
+		t.Fatalf("refresh: got %d %v", status, body)
+	}
+
+	second, access := body["refresh_token"].(string), body["access_token"].(string)
+	if second == first {
+		t.Error("the refresh token wasn't rotated")
+	}
+
+	if status := f.genres(t, access); status != http.StatusOK {
+		t.Errorf("genres after refresh: got %d", status)
+	}
+
+	// presenting the rotated token again revokes the whole family
+	status, body = refresh(first, false)
+	wantOAuthError(t, status, body, http.StatusBadRequest, "invalid_grant")
+
+	status, body = refresh(second, false)
+	wantOAuthError(t, status, body, http.StatusBadRequest, "invalid_grant")
+
+	if status := f.genres(t, access); status != http.StatusUnauthorized {
+		t.Errorf("access token of a revoked family: got %d, want 401", status)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/yousifsabah0/blackbox/internal/data"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+func (app *application) handleShowRevisions(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ParseIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movie.Select(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var filters data.Filters
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filters.Page = app.ReadInt(qs, "page", 1, v)
+	filters.PageSize = app.ReadInt(qs, "page_size", 20, v)
+
+	filters.Sort = app.ReadString(qs, "sort", "-version")
+	filters.SortSafeList = []string{"version", "-version"}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	revisions, metadata, err := app.models.Revision.SelectForMovie(movie.ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"revisions": revisions, "metadata": metadata}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleDiffRevisions(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ParseIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	from := app.ReadInt(qs, "from", 0, v)
+	to := app.ReadInt(qs, "to", 0, v)
+
+	v.Check(from > 0, "from", "must be a positive version number")
+	v.Check(to > 0, "to", "must be a positive version number")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	versions := make([]*data.Revision, 0, 2)
+	for _, version := range []int{from, to} {
+		revision, err := app.models.Revision.Select(id, int32(version))
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				app.notFoundResponse(w, r)
+				return
+			}
+
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		versions = append(versions, revision)
+	}
+
+	response := envelope{
+		"from":    versions[0],
+		"to":      versions[1],
+		"changes": versions[0].Diff(versions[1]),
+	}
+
+	if err := app.JSON(w, http.StatusOK, response); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleRevertMovie(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ParseIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movie.Select(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Version is the revision to go back to, ExpectedVersion the version
+	// the client last saw, unless it's sent as If-Match instead
+	var input struct {
+		Version         int32  `json:"version"`
+		ExpectedVersion *int32 `json:"expected_version"`
+	}
+
+	if err := app.Bind(r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" && input.ExpectedVersion == nil {
+		v.AddErrors("expected_version", "must be provided unless the If-Match header is set")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if ifMatch != "" && !matchVersionETag(ifMatch, movie.Version) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	if input.ExpectedVersion != nil && *input.ExpectedVersion != movie.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	revision, err := app.models.Revision.Select(movie.ID, input.Version)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddErrors("version", "no matching revision found")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	revision.Apply(movie)
+
+	genres, err := app.models.Genre.Vocabulary()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if data.ValidateMovie(v, movie, genres); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.models.Movie.Update(movie, app.contextGetUser(r).ID); err != nil {
+		if errors.Is(err, data.ErrEditConflict) {
+			app.editConflictResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.attachRelations(data.DefaultProjection(), movie); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	etag, err := movieETag(movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	if err := app.JSON(w, http.StatusOK, envelope{"movie": movie}, headers); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/yousifsabah0/blackbox/internal/data"
+)
+
+func (app *application) handleShowSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := app.models.Session.SelectAllForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if current := app.contextGetSession(r); current != nil {
+		for _, session := range sessions {
+			session.Current = session.ID == current.ID
+		}
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"sessions": sessions}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ParseIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if err := app.models.Session.Delete(app.contextGetUser(r).ID, id); err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.revoked.Add(id)
+
+	if err := app.JSON(w, http.StatusOK, envelope{"message": app.revocationMessage("session revoked")}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// handleDeleteAllSessions logs the user out everywhere, the current
+// session included
+func (app *application) handleDeleteAllSessions(w http.ResponseWriter, r *http.Request) {
+	ids, err := app.models.Session.DeleteAllForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.revoked.Add(ids...)
+
+	if err := app.JSON(w, http.StatusOK, envelope{"message": app.revocationMessage("logged out of every session")}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/yousifsabah0/blackbox/internal/data"
+	"github.com/yousifsabah0/blackbox/internal/jwt"
 	"github.com/yousifsabah0/blackbox/internal/validator"
 )
 
@@ -52,17 +55,167 @@ func (app *application) handleCreateAuthenticationTokenHandler(w http.ResponseWr
 		return
 	}
 
-	token, err := app.models.Token.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	session := &data.Session{
+		UserID:    user.ID,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+
+	token, refreshToken, err := app.models.Token.NewPair(session, app.storedAccessTTL(), app.config.auth.refreshTTL)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	if err := app.JSON(w, http.StatusOK, envelope{"token": token}); err != nil {
+	if app.signer != nil {
+		if token, err = app.signAccessToken(user, session.ID, nil, nil); err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"token": token, "refresh_token": refreshToken}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	if err := app.Bind(r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidTokenText(v, input.Token); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	token, refreshToken, err := app.models.Token.Rotate(input.Token, nil, app.storedAccessTTL(), app.config.auth.refreshTTL)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTokenReused):
+			var reused *data.ReuseError
+			if errors.As(err, &reused) {
+				app.revoked.Add(reused.SessionID)
+			}
+
+			app.logger.Info("refresh token reused, token family revoked", map[string]string{
+				"remote_addr": r.RemoteAddr,
+			})
+			app.invalidAuthenticationTokenResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if app.signer != nil {
+		user, err := app.models.User.Get(refreshToken.UserID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if token, err = app.signAccessToken(user, refreshToken.SessionID, nil, refreshToken.Scopes); err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"token": token, "refresh_token": refreshToken}); err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// storedAccessTTL is the lifetime of the access tokens kept in the
+// database, none are when they are signed
+func (app *application) storedAccessTTL() time.Duration {
+	if app.signer != nil {
+		return 0
+	}
+
+	return app.config.auth.accessTTL
+}
+
+// signAccessToken issues a signed access token for the session, it
+// carries the user's permissions, narrowed down to the scopes unless they
+// are nil, so that requests made with it skip the database. clientID is
+// the OAuth client of the session, if any. Permissions revoked or an
+// account deactivated after signing only show once the token is
+// refreshed, up to accessTTL later.
+func (app *application) signAccessToken(user *data.User, sessionID int64, clientID *int64, scopes []string) (*data.Token, error) {
+	permissions, err := app.models.Permission.GetUserPermissions(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if scopes != nil {
+		permissions = permissions.Narrow(scopes)
+	}
+
+	now := time.Now()
+	expiry := now.Add(app.config.auth.accessTTL)
+
+	claims := jwt.Claims{
+		Subject:     strconv.FormatInt(user.ID, 10),
+		SessionID:   sessionID,
+		Activated:   user.Activated,
+		Permissions: permissions,
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   expiry.Unix(),
+	}
+
+	if clientID != nil {
+		claims.ClientID = *clientID
+	}
+
+	text, err := app.signer.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Token{Text: text, UserID: user.ID, Expiry: expiry, Scope: data.ScopeAuthentication, SessionID: sessionID}, nil
+}
+
+// handleDeleteAuthenticationToken logs out the session of the token the
+// request was made with
+func (app *application) handleDeleteAuthenticationToken(w http.ResponseWriter, r *http.Request) {
+	session := app.contextGetSession(r)
+	if session == nil {
+		app.badRequestResponse(w, r, errors.New("api keys are revoked through /api/v1/users/me/api-keys"))
+		return
+	}
+
+	if err := app.models.Session.Revoke(session); err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.revoked.Add(session.ID)
+
+	if err := app.JSON(w, http.StatusOK, envelope{"message": app.revocationMessage("logged out")}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revocationMessage tells the client about the delay of revoking signed
+// access tokens: this instance rejects them right away, the others keep
+// accepting them until they expire
+func (app *application) revocationMessage(message string) string {
+	if app.signer == nil {
+		return message
+	}
+
+	return fmt.Sprintf("%s, access tokens already issued may be accepted for up to %s", message, app.config.auth.accessTTL)
+}
+
 func (app *application) handleResendActivationToken(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Email string `json:"email"`
@@ -49,7 +49,7 @@ func (app *application) handleUserRegister(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if err := app.models.Permission.GrantUser(user.ID, "movies:read"); err != nil {
+	if err := app.models.Permission.GrantUser(user.ID, "movies:read", "reviews:write", "watchlist:read", "watchlist:write", "comments:write"); err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
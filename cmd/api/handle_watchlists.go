@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/yousifsabah0/blackbox/internal/data"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+func (app *application) handleShowWatchlist(w http.ResponseWriter, r *http.Request) {
+	var filters data.Filters
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filters.Page = app.ReadInt(qs, "page", 1, v)
+	filters.PageSize = app.ReadInt(qs, "page_size", 20, v)
+
+	filters.Sort = app.ReadString(qs, "sort", "-added_at")
+	filters.SortSafeList = []string{"added_at", "title", "year", "-added_at", "-title", "-year"}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	watchlist, metadata, err := app.models.Watchlist.SelectForUser(user.ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	movies := make([]*data.Movie, len(watchlist))
+	for i, entry := range watchlist {
+		movies[i] = entry.Movie
+	}
+
+	if err := app.displayGenres(movies...); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"watchlist": watchlist, "metadata": metadata}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleAddToWatchlist(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MovieID int64 `json:"movie_id"`
+	}
+
+	if err := app.Bind(r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	movie, err := app.models.Movie.Select(input.MovieID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddErrors("movie_id", "no matching movie found")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	entry, err := app.models.Watchlist.Add(user.ID, movie.ID)
+	if err != nil {
+		if errors.Is(err, data.ErrDuplicateWatchlistEntry) {
+			v.AddErrors("movie_id", "movie is already in your watchlist")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	entry.Movie = movie
+
+	if err := app.displayGenres(movie); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusCreated, envelope{"entry": entry}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleRemoveFromWatchlist(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ParseIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	if err := app.models.Watchlist.Remove(user.ID, id); err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"message": "deleted"}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleShowHistory(w http.ResponseWriter, r *http.Request) {
+	var filters data.Filters
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filters.Page = app.ReadInt(qs, "page", 1, v)
+	filters.PageSize = app.ReadInt(qs, "page_size", 20, v)
+
+	filters.Sort = app.ReadString(qs, "sort", "-watched_at")
+	filters.SortSafeList = []string{"watched_at", "title", "year", "-watched_at", "-title", "-year"}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	history, metadata, err := app.models.History.SelectForUser(user.ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	movies := make([]*data.Movie, len(history))
+	for i, entry := range history {
+		movies[i] = entry.Movie
+	}
+
+	if err := app.displayGenres(movies...); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"history": history, "metadata": metadata}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleAddToHistory(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MovieID   int64      `json:"movie_id"`
+		WatchedAt *time.Time `json:"watched_at"`
+	}
+
+	if err := app.Bind(r, &input); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	movie, err := app.models.Movie.Select(input.MovieID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddErrors("movie_id", "no matching movie found")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	entry := &data.HistoryEntry{
+		Movie:     movie,
+		WatchedAt: time.Now(),
+	}
+
+	if input.WatchedAt != nil {
+		entry.WatchedAt = *input.WatchedAt
+	}
+
+	if data.ValidateHistoryEntry(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	if err := app.models.History.Insert(user.ID, entry); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.displayGenres(entry.Movie); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusCreated, envelope{"entry": entry}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) handleRemoveFromHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ParseIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	if err := app.models.History.Delete(user.ID, id); err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.JSON(w, http.StatusOK, envelope{"message": "deleted"}); err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/yousifsabah0/blackbox/internal/validator"
@@ -19,6 +21,14 @@ type envelope map[string]any
 const (
 	jsonContentType = "application/json"
 	maxBodyBytes    = 1_048_567
+	maxImportBytes  = 64 << 20
+
+	// uploadMemoryBytes is how much of a multipart upload is kept in
+	// memory, the rest is buffered in temporary files
+	uploadMemoryBytes = 1 << 20
+
+	exportChunkSize    = 500
+	exportWriteTimeout = 30 * time.Second
 )
 
 // ReadString returns a string value from the query string
@@ -59,13 +69,54 @@ func (app *application) ReadInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// ReadBool reads a string from the query string and convert it into
+// a boolean
+func (app *application) ReadBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddErrors(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+// ReadTime reads a RFC 3339 timestamp or a plain date from the query
+// string
+func (app *application) ReadTime(qs url.Values, key string, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return time.Time{}
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+
+	v.AddErrors(key, "must be a RFC 3339 timestamp or a YYYY-MM-DD date")
+	return time.Time{}
+}
+
 // ParseIDParams used to get the query parameters for the id
 //
 //	from the request
 func (app *application) ParseIDParams(r *http.Request) (int64, error) {
+	return app.ParseNamedIDParams(r, "id")
+}
+
+// ParseNamedIDParams is like ParseIDParams but reads the id from
+// the named route parameter
+func (app *application) ParseNamedIDParams(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil {
 		return 0, err
 	}
@@ -73,6 +124,16 @@ func (app *application) ParseIDParams(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+// clientIP returns the address the request came from, without its port
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return ip
+}
+
 // JSON is a helper method to write JSON responses
 func (app *application) JSON(w http.ResponseWriter, status int, v envelope, headers ...http.Header) error {
 	payload, err := json.Marshal(&v)
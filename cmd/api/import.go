@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yousifsabah0/blackbox/internal/catalog"
+	"github.com/yousifsabah0/blackbox/internal/data"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+const (
+	importBatchSize = 500
+
+	importCreated = "created"
+	importSkipped = "skipped"
+	importInvalid = "invalid"
+
+	// importFailed marks the row an import stopped at, importNotCommitted
+	// the valid rows that were waiting for their batch to be written then
+	importFailed       = "failed"
+	importNotCommitted = "not_committed"
+)
+
+type importResult struct {
+	Line   int               `json:"line"`
+	Status string            `json:"status"`
+	ID     int64             `json:"id,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// importReport lists what happened to every row read. Batches are
+// committed one at a time, when an import stops part way Aborted is set,
+// Created counts the committed rows and FailedLine is the row it stopped
+// at, if a row is to blame.
+type importReport struct {
+	DryRun  bool           `json:"dry_run"`
+	Created int            `json:"created"`
+	Skipped int            `json:"skipped"`
+	Invalid int            `json:"invalid"`
+	Rows    []importResult `json:"rows"`
+
+	Aborted    bool `json:"aborted"`
+	FailedLine int  `json:"failed_line,omitempty"`
+}
+
+// importMovies validates every row of the reader and inserts the valid
+// ones in batches, rows matching an existing movie or an earlier row are
+// skipped. Nothing is written when dryRun is set. When an error stops the
+// import, the report of what was committed up to then is returned along
+// with it.
+func (app *application) importMovies(reader catalog.Reader, userID int64, dryRun bool) (*importReport, error) {
+	genres, err := app.models.Genre.Vocabulary()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &importReport{DryRun: dryRun, Rows: []importResult{}}
+
+	seen := make(map[string]bool)
+
+	var pending []*data.Movie
+	var pendingRows []int
+
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+
+		existing, err := app.models.Movie.FindExisting(pending)
+		if err != nil {
+			return err
+		}
+
+		var movies []*data.Movie
+		var rows []int
+
+		for i, movie := range pending {
+			if existing[i] {
+				report.Rows[pendingRows[i]].Status = importSkipped
+				report.Rows[pendingRows[i]].Errors = map[string]string{"title": "movie already exists"}
+				report.Skipped++
+				continue
+			}
+
+			movies = append(movies, movie)
+			rows = append(rows, pendingRows[i])
+		}
+
+		if !dryRun && len(movies) > 0 {
+			if err := app.models.Movie.InsertBatch(movies, userID); err != nil {
+				var rowErr *data.BatchRowError
+				if errors.As(err, &rowErr) {
+					result := &report.Rows[rows[rowErr.Index]]
+					result.Status = importFailed
+					result.Errors = map[string]string{"row": rowErr.Err.Error()}
+					report.FailedLine = result.Line
+				}
+
+				return err
+			}
+		}
+
+		for i, movie := range movies {
+			report.Rows[rows[i]].Status = importCreated
+			report.Rows[rows[i]].ID = movie.ID
+			report.Created++
+		}
+
+		pending, pendingRows = nil, nil
+
+		return nil
+	}
+
+	// abort marks the rows left uncommitted, they are all in the pending
+	// batch
+	abort := func(err error) (*importReport, error) {
+		for _, row := range pendingRows {
+			if report.Rows[row].Status == "" {
+				report.Rows[row].Status = importNotCommitted
+			}
+		}
+
+		report.Aborted = true
+
+		return report, err
+	}
+
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return abort(err)
+		}
+
+		result := importResult{Line: record.Line}
+
+		if record.Err != nil {
+			result.Status = importInvalid
+			result.Errors = map[string]string{"row": record.Err.Error()}
+			report.Rows = append(report.Rows, result)
+			report.Invalid++
+			continue
+		}
+
+		v := validator.New()
+		if data.ValidateMovie(v, record.Movie, genres); !v.Valid() {
+			result.Status = importInvalid
+			result.Errors = v.Errors
+			report.Rows = append(report.Rows, result)
+			report.Invalid++
+			continue
+		}
+
+		key := fmt.Sprintf("%s|%d", strings.ToLower(record.Movie.Title), record.Movie.Year)
+		if seen[key] {
+			result.Status = importSkipped
+			result.Errors = map[string]string{"title": "duplicate of an earlier row"}
+			report.Rows = append(report.Rows, result)
+			report.Skipped++
+			continue
+		}
+		seen[key] = true
+
+		report.Rows = append(report.Rows, result)
+		pending = append(pending, record.Movie)
+		pendingRows = append(pendingRows, len(report.Rows)-1)
+
+		if len(pending) == importBatchSize {
+			if err := flush(); err != nil {
+				return abort(err)
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return abort(err)
+	}
+
+	return report, nil
+}
+
+// runImport imports the catalog file given on the command line and
+// writes the report to stdout
+func (app *application) runImport() error {
+	format := app.config.importer.format
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(app.config.importer.file), ".")
+	}
+
+	file, err := os.Open(app.config.importer.file)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := catalog.NewReader(file, format)
+	if err != nil {
+		return err
+	}
+
+	report, importErr := app.importMovies(reader, 0, app.config.importer.dryRun)
+	if report == nil {
+		return importErr
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "\t")
+
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+
+	return importErr
+}
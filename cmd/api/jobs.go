@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+const (
+	purgeInterval = time.Hour
+)
+
+// purge permanently deletes what is only kept for a while, it runs until
+// stop is closed
+func (app *application) purge(stop <-chan struct{}) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if app.config.trash.retention > 0 {
+			app.purgeTrashedMovies()
+		}
+
+		app.purgeExpiredSessions()
+		app.purgeExpiredOAuthCodes()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeTrashedMovies permanently deletes the movies that stayed in the
+// trash longer than the configured retention, along with their images
+func (app *application) purgeTrashedMovies() {
+	purged, images, err := app.models.Movie.PurgeTrashedBefore(time.Now().Add(-app.config.trash.retention))
+	if err != nil {
+		app.logger.Error(err, nil)
+		return
+	}
+
+	if purged > 0 {
+		app.deleteImageFiles(context.Background(), images...)
+
+		app.logger.Info("purged trashed movies", map[string]string{
+			"count": strconv.FormatInt(purged, 10),
+		})
+	}
+}
+
+// purgeExpiredSessions deletes the expired tokens and the sessions none
+// of whose tokens are left
+func (app *application) purgeExpiredSessions() {
+	purged, err := app.models.Session.DeleteExpired()
+	if err != nil {
+		app.logger.Error(err, nil)
+		return
+	}
+
+	if purged > 0 {
+		app.logger.Info("purged expired sessions", map[string]string{
+			"count": strconv.FormatInt(purged, 10),
+		})
+	}
+}
+
+// purgeExpiredOAuthCodes deletes the authorization codes that were never
+// traded for tokens
+func (app *application) purgeExpiredOAuthCodes() {
+	purged, err := app.models.OAuthCode.DeleteExpired()
+	if err != nil {
+		app.logger.Error(err, nil)
+		return
+	}
+
+	if purged > 0 {
+		app.logger.Info("purged expired authorization codes", map[string]string{
+			"count": strconv.FormatInt(purged, 10),
+		})
+	}
+}
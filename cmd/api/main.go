@@ -4,18 +4,24 @@ import (
 	"context"
 	"database/sql"
 	"flag"
+	"fmt"
 	"os"
 	"sync"
 	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/yousifsabah0/blackbox/internal/data"
+	"github.com/yousifsabah0/blackbox/internal/jwt"
 	"github.com/yousifsabah0/blackbox/internal/logx"
 	"github.com/yousifsabah0/blackbox/internal/mailer"
+	"github.com/yousifsabah0/blackbox/internal/storage"
 )
 
 const (
 	version = "v1.0.0"
+
+	tokenFormatOpaque = "opaque"
+	tokenFormatSigned = "signed"
 )
 
 type config struct {
@@ -36,14 +42,41 @@ type config struct {
 		password string
 		sender   string
 	}
+	trash struct {
+		retention time.Duration
+	}
+	importer struct {
+		file   string
+		format string
+		dryRun bool
+	}
+	images struct {
+		dir      string
+		url      string
+		maxBytes int64
+	}
+	stats struct {
+		cacheTTL  time.Duration
+		cacheSize int
+	}
+	auth struct {
+		accessTTL   time.Duration
+		refreshTTL  time.Duration
+		tokenFormat string
+		signingKeys string
+	}
 }
 
 type application struct {
-	config config
-	logger *logx.Logger
-	models data.Model
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config  config
+	logger  *logx.Logger
+	models  data.Model
+	mailer  mailer.Mailer
+	storage storage.Storage
+	stats   *responseCache
+	signer  *jwt.Keyring
+	revoked *revocations
+	wg      sync.WaitGroup
 }
 
 func main() {
@@ -66,10 +99,33 @@ func main() {
 
 	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "no-replay@blackbox.com", "")
 
+	flag.DurationVar(&cfg.auth.accessTTL, "access-token-ttl", 15*time.Minute, "how long authentication tokens are valid for")
+	flag.DurationVar(&cfg.auth.refreshTTL, "refresh-token-ttl", 30*24*time.Hour, "how long refresh tokens are valid for")
+	flag.StringVar(&cfg.auth.tokenFormat, "token-format", tokenFormatOpaque, "format of the authentication tokens, opaque or signed")
+	flag.StringVar(&cfg.auth.signingKeys, "token-signing-keys", "", "comma separated kid:algorithm:base64 secret keys signed tokens use, the first one signs")
+
+	flag.StringVar(&cfg.importer.file, "import", "", "import the movies of a csv or ndjson file and exit")
+	flag.StringVar(&cfg.importer.format, "import-format", "", "format of the import file, defaults to its extension")
+	flag.BoolVar(&cfg.importer.dryRun, "import-dry-run", false, "validate the import file without writing anything")
+
+	flag.StringVar(&cfg.images.dir, "images-dir", "./uploads", "directory uploaded images are stored in")
+	flag.StringVar(&cfg.images.url, "images-url", "/api/v1/images", "base url uploaded images are served from")
+	flag.Int64Var(&cfg.images.maxBytes, "images-max-bytes", 10<<20, "maximum size of an image upload")
+
+	flag.DurationVar(&cfg.stats.cacheTTL, "stats-cache-ttl", time.Minute, "how long catalog statistics are cached, 0 disables caching")
+	flag.IntVar(&cfg.stats.cacheSize, "stats-cache-size", 1000, "how many distinct searches catalog statistics are cached for")
+
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "how long trashed movies are kept before being purged, 0 disables purging")
+
 	flag.Parse()
 
 	logger := logx.NewLogger(os.Stdout, logx.LevelInfo)
 
+	signer, err := openSigner(cfg.auth.tokenFormat, cfg.auth.signingKeys)
+	if err != nil {
+		logger.Fatal(err, nil)
+	}
+
 	db, err := openDB(cfg.db.dsn)
 	if err != nil {
 		logger.Fatal(err, nil)
@@ -80,10 +136,22 @@ func main() {
 	mailer := mailer.New(cfg.smtp.host, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender, cfg.smtp.port)
 
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModel(db),
-		mailer: mailer,
+		config:  cfg,
+		logger:  logger,
+		models:  data.NewModel(db),
+		mailer:  mailer,
+		storage: storage.NewLocal(cfg.images.dir, cfg.images.url),
+		stats:   newResponseCache(cfg.stats.cacheTTL, cfg.stats.cacheSize),
+		signer:  signer,
+		revoked: newRevocations(cfg.auth.accessTTL),
+	}
+
+	if cfg.importer.file != "" {
+		if err := app.runImport(); err != nil {
+			logger.Fatal(err, nil)
+		}
+
+		return
 	}
 
 	if err := app.serve(); err != nil {
@@ -106,3 +174,21 @@ func openDB(dsn string) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// openSigner returns the keyring access tokens are signed with, or nil
+// when they are opaque
+func openSigner(format, keys string) (*jwt.Keyring, error) {
+	switch format {
+	case tokenFormatOpaque:
+		return nil, nil
+	case tokenFormatSigned:
+		parsed, err := jwt.ParseKeys(keys)
+		if err != nil {
+			return nil, err
+		}
+
+		return jwt.NewKeyring(parsed...)
+	default:
+		return nil, fmt.Errorf("unknown token format %q", format)
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/yousifsabah0/blackbox/internal/data"
+	"github.com/yousifsabah0/blackbox/internal/jwt"
 	"github.com/yousifsabah0/blackbox/internal/validator"
 	"golang.org/x/time/rate"
 )
@@ -84,6 +86,12 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
+		w.Header().Add("Vary", "X-API-Key")
+
+		if key := r.Header.Get("X-API-Key"); key != "" {
+			app.authenticateAPIKey(w, r, next, key)
+			return
+		}
 
 		authorizationHeader := r.Header.Get("Authorization")
 		if authorizationHeader == "" {
@@ -93,6 +101,11 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) == 2 && headerParts[0] == "ApiKey" {
+			app.authenticateAPIKey(w, r, next, headerParts[1])
+			return
+		}
+
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
 			app.invalidAuthenticationTokenResponse(w, r)
 			return
@@ -100,13 +113,40 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 
 		token := headerParts[1]
 
+		if app.signer != nil && jwt.LooksLike(token) {
+			claims, err := app.signer.Verify(token)
+			if err != nil || app.revoked.Contains(claims.SessionID) {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+			if err != nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			// signed tokens don't touch their session, refreshing them does
+			user := &data.User{ID: userID, Activated: claims.Activated}
+			session := &data.Session{ID: claims.SessionID, UserID: userID, LastUsedAt: time.Now()}
+			if claims.ClientID != 0 {
+				session.ClientID = &claims.ClientID
+			}
+
+			r = app.contextSetUser(r, user)
+			r = app.contextSetSession(r, session)
+			r = app.contextSetPermissions(r, claims.Permissions)
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		v := validator.New()
 		if data.ValidTokenText(v, token); !v.Valid() {
 			app.invalidAuthenticationTokenResponse(w, r)
 			return
 		}
 
-		user, err := app.models.User.GetForToken(data.ScopeAuthentication, token)
+		user, session, err := app.models.Session.GetForToken(token)
 		if err != nil {
 			if errors.Is(err, data.ErrRecordNotFound) {
 				app.invalidAuthenticationTokenResponse(w, r)
@@ -117,11 +157,62 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		// the last use is only written once it's gone stale, and off the
+		// request path
+		if session.Stale() {
+			ip := clientIP(r)
+			app.background(func() {
+				if err := app.models.Session.Touch(session.ID, ip); err != nil {
+					app.logger.Error(err, nil)
+				}
+			})
+		}
+
 		r = app.contextSetUser(r, user)
+		r = app.contextSetSession(r, session)
+
+		if session.Scopes != nil {
+			r = app.contextSetPermissions(r, session.Scopes)
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
 
+// authenticateAPIKey authenticates the request as the owner of the api
+// key, with the permissions granted to the key
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, text string) {
+	v := validator.New()
+	if data.ValidAPIKeyText(v, text); !v.Valid() {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	user, key, err := app.models.APIKey.GetForKey(text)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if key.Stale() {
+		ip := clientIP(r)
+		app.background(func() {
+			if err := app.models.APIKey.Touch(key.ID, ip); err != nil {
+				app.logger.Error(err, nil)
+			}
+		})
+	}
+
+	r = app.contextSetUser(r, user)
+	r = app.contextSetPermissions(r, key.Permissions)
+	next.ServeHTTP(w, r)
+}
+
 func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
@@ -134,6 +225,23 @@ func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.Han
 	})
 }
 
+// requireFirstPartySession only lets through requests made with a login of
+// the user, not with an api key nor with a token issued to an OAuth client,
+// it guards the endpoints that manage the account's credentials
+func (app *application) requireFirstPartySession(next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := app.contextGetSession(r)
+		if session == nil || session.ClientID != nil {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	return app.requireAuthenticatedUser(fn)
+}
+
 func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
@@ -152,10 +260,13 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
 
-		permissions, err := app.models.Permission.GetUserPermissions(user.ID)
-		if err != nil {
-			app.serverErrorResponse(w, r, err)
-			return
+		permissions, ok := app.contextGetPermissions(r)
+		if !ok {
+			var err error
+			if permissions, err = app.models.Permission.GetUserPermissions(user.ID); err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
 		}
 
 		if !permissions.Contains(code) {
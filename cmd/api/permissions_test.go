@@ -0,0 +1,151 @@
+package main
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yousifsabah0/blackbox/internal/data"
+	"github.com/yousifsabah0/blackbox/internal/jwt"
+	"github.com/yousifsabah0/blackbox/internal/logx"
+)
+
+// guardedRoutes are the routes that need a permission other than the
+// movies:read every user starts with
+var guardedRoutes = []struct {
+	method, path, permission string
+}{
+	{http.MethodPost, "/api/v1/movies/1/reviews", "reviews:write"},
+	{http.MethodPatch, "/api/v1/movies/1/reviews/1/edit", "reviews:write"},
+	{http.MethodDelete, "/api/v1/movies/1/reviews/1/delete", "reviews:write"},
+	{http.MethodGet, "/api/v1/users/me/watchlist", "watchlist:read"},
+	{http.MethodPost, "/api/v1/users/me/watchlist", "watchlist:write"},
+	{http.MethodDelete, "/api/v1/users/me/watchlist/1", "watchlist:write"},
+	{http.MethodGet, "/api/v1/users/me/history", "watchlist:read"},
+	{http.MethodPost, "/api/v1/users/me/history", "watchlist:write"},
+	{http.MethodDelete, "/api/v1/users/me/history/1", "watchlist:write"},
+	{http.MethodPost, "/api/v1/movies/1/comments", "comments:write"},
+	{http.MethodPatch, "/api/v1/movies/1/comments/1/edit", "comments:write"},
+	{http.MethodDelete, "/api/v1/movies/1/comments/1/delete", "comments:write"},
+	{http.MethodPut, "/api/v1/movies/1/comments/1/hide", "comments:moderate"},
+}
+
+// guardTestServer serves the routes of an application that signs its
+// access tokens, whose permissions are read from the token so that no
+// database is needed. Requests that get past the guards fail on the
+// unreachable database instead.
+type guardTestServer struct {
+	t   *testing.T
+	app *application
+	ts  *httptest.Server
+}
+
+func newGuardTestServer(t *testing.T) *guardTestServer {
+	t.Helper()
+
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	app := &application{
+		logger:  logx.NewLogger(io.Discard, logx.LevelInfo),
+		models:  data.NewModel(db),
+		signer:  testSigner(t),
+		revoked: newRevocations(time.Minute),
+	}
+
+	ts := httptest.NewServer(app.routes())
+	t.Cleanup(ts.Close)
+
+	return &guardTestServer{t: t, app: app, ts: ts}
+}
+
+// token signs an access token of an activated user, clientID is the OAuth
+// client of its session, 0 for a login
+func (s *guardTestServer) token(clientID int64, permissions ...string) string {
+	s.t.Helper()
+
+	text, err := s.app.signer.Sign(jwt.Claims{
+		Subject:     "1",
+		SessionID:   1,
+		ClientID:    clientID,
+		Activated:   true,
+		Permissions: permissions,
+		IssuedAt:    time.Now().Unix(),
+		ExpiresAt:   time.Now().Add(time.Minute).Unix(),
+	})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	return text
+}
+
+func (s *guardTestServer) send(method, path, token string) int {
+	s.t.Helper()
+
+	req, err := http.NewRequest(method, s.ts.URL+path, strings.NewReader(`{}`))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := s.ts.Client().Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	res.Body.Close()
+
+	return res.StatusCode
+}
+
+func TestRoutePermissions(t *testing.T) {
+	s := newGuardTestServer(t)
+
+	for _, route := range guardedRoutes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			if status := s.send(route.method, route.path, s.token(0, "movies:read")); status != http.StatusForbidden {
+				t.Errorf("without %s: got %d, want 403", route.permission, status)
+			}
+
+			if status := s.send(route.method, route.path, s.token(0, route.permission)); status == http.StatusForbidden || status == http.StatusUnauthorized {
+				t.Errorf("with %s: got %d", route.permission, status)
+			}
+		})
+	}
+}
+
+// firstPartyRoutes manage the account, they can only be used from a login
+// of the user
+var firstPartyRoutes = []struct {
+	method, path string
+}{
+	{http.MethodGet, "/api/v1/users/me/sessions"},
+	{http.MethodDelete, "/api/v1/users/me/sessions"},
+	{http.MethodDelete, "/api/v1/users/me/sessions/1"},
+	{http.MethodGet, "/api/v1/users/me/api-keys"},
+	{http.MethodPost, "/api/v1/users/me/api-keys"},
+	{http.MethodDelete, "/api/v1/users/me/api-keys/1"},
+}
+
+func TestFirstPartyRoutes(t *testing.T) {
+	s := newGuardTestServer(t)
+
+	for _, route := range firstPartyRoutes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			if status := s.send(route.method, route.path, s.token(7, "movies:read")); status != http.StatusForbidden {
+				t.Errorf("with a client's token: got %d, want 403", status)
+			}
+
+			if status := s.send(route.method, route.path, s.token(0, "movies:read")); status == http.StatusForbidden || status == http.StatusUnauthorized {
+				t.Errorf("with a login: got %d", status)
+			}
+		})
+	}
+}
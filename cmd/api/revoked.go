@@ -0,0 +1,59 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// revocations remembers the sessions revoked on this instance for as long
+// as the signed access tokens issued for them can still be valid. Signed
+// tokens are checked against it instead of the database, so other
+// instances keep accepting them until they expire, up to the access token
+// TTL.
+type revocations struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[int64]time.Time
+}
+
+func newRevocations(ttl time.Duration) *revocations {
+	return &revocations{ttl: ttl, sessions: make(map[int64]time.Time)}
+}
+
+// Add marks the sessions as revoked, expired entries are dropped on the
+// way so the set only holds the tokens that could still be presented
+func (s *revocations) Add(ids ...int64) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, expires := range s.sessions {
+		if now.After(expires) {
+			delete(s.sessions, id)
+		}
+	}
+
+	for _, id := range ids {
+		if id != 0 {
+			s.sessions[id] = now.Add(s.ttl)
+		}
+	}
+}
+
+// Contains reports whether the session was revoked recently enough for
+// its signed tokens to still be valid
+func (s *revocations) Contains(id int64) bool {
+	if s == nil || id == 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expires, ok := s.sessions[id]
+	return ok && time.Now().Before(expires)
+}
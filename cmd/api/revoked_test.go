@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRevocations(t *testing.T) {
+	revoked := newRevocations(time.Minute)
+	revoked.Add(1, 2)
+
+	if !revoked.Contains(1) || !revoked.Contains(2) || revoked.Contains(3) {
+		t.Error("only the added sessions should be revoked")
+	}
+
+	// entries outlive the tokens they stand for by no more than the TTL
+	revoked.sessions[1] = time.Now().Add(-time.Second)
+	if revoked.Contains(1) {
+		t.Error("expired entries must not be revoked anymore")
+	}
+
+	revoked.Add(4)
+	if _, ok := revoked.sessions[1]; ok {
+		t.Error("expired entries should be dropped when adding")
+	}
+
+	var disabled *revocations
+	disabled.Add(5)
+	if disabled.Contains(5) {
+		t.Error("a nil set revokes nothing")
+	}
+}
@@ -17,20 +17,121 @@ func (app *application) routes() http.Handler {
 
 	// Movies routes
 	router.HandlerFunc(http.MethodGet, "/api/v1/movies", app.requirePermission("movies:read", app.handleShowAllMovies))
-	router.HandlerFunc(http.MethodGet, "/api/v1/movies/:id", app.requirePermission("movies:read", app.handleShowMovie))
+	router.HandlerFunc(http.MethodGet, "/api/v1/movies/:id", app.dispatchStatic(map[string]http.HandlerFunc{
+		"export": app.requirePermission("movies:read", app.handleExportMovies),
+		"stats":  app.requirePermission("movies:read", app.handleMovieStats),
+	}, app.requirePermission("movies:read", app.handleShowMovie)))
 
 	router.HandlerFunc(http.MethodPost, "/api/v1/movies", app.requirePermission("movies:write", app.handleCreateMovie))
+	router.HandlerFunc(http.MethodPost, "/api/v1/movies/:id", app.dispatchStatic(map[string]http.HandlerFunc{
+		"batch":  app.requirePermission("movies:write", app.handleBatchMovies),
+		"import": app.requirePermission("movies:write", app.handleImportMovies),
+	}, app.notFoundResponse))
 
 	router.HandlerFunc(http.MethodPatch, "/api/v1/movies/:id/edit", app.requirePermission("movies:write", app.handleUpdateMovie))
 	router.HandlerFunc(http.MethodDelete, "/api/v1/movies/:id/delete", app.requirePermission("movies:write", app.handleDeleteMovie))
 
+	// Revisions routes
+	router.HandlerFunc(http.MethodGet, "/api/v1/movies/:id/revisions", app.requirePermission("movies:read", app.handleShowRevisions))
+	router.HandlerFunc(http.MethodGet, "/api/v1/movies/:id/revisions/diff", app.requirePermission("movies:read", app.handleDiffRevisions))
+
+	router.HandlerFunc(http.MethodPost, "/api/v1/movies/:id/revert", app.requirePermission("movies:write", app.handleRevertMovie))
+
+	// Trash routes
+	router.HandlerFunc(http.MethodGet, "/api/v1/admin/movies/trash", app.requirePermission("movies:admin", app.handleShowTrash))
+	router.HandlerFunc(http.MethodPut, "/api/v1/admin/movies/trash/:id/restore", app.requirePermission("movies:admin", app.handleRestoreMovie))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/admin/movies/trash/:id/purge", app.requirePermission("movies:admin", app.handlePurgeMovie))
+
+	// Genres routes
+	router.HandlerFunc(http.MethodGet, "/api/v1/genres", app.requirePermission("movies:read", app.handleShowAllGenres))
+	router.HandlerFunc(http.MethodGet, "/api/v1/genres/:id", app.requirePermission("movies:read", app.handleShowGenre))
+
+	router.HandlerFunc(http.MethodPost, "/api/v1/admin/genres", app.requirePermission("movies:admin", app.handleCreateGenre))
+	router.HandlerFunc(http.MethodPost, "/api/v1/admin/genres/:id/aliases", app.requirePermission("movies:admin", app.handleAddGenreAlias))
+	router.HandlerFunc(http.MethodPost, "/api/v1/admin/genres/:id/merge", app.requirePermission("movies:admin", app.handleMergeGenre))
+
+	router.HandlerFunc(http.MethodPatch, "/api/v1/admin/genres/:id/rename", app.requirePermission("movies:admin", app.handleRenameGenre))
+
+	// Images routes
+	router.HandlerFunc(http.MethodGet, "/api/v1/movies/:id/images", app.requirePermission("movies:read", app.handleShowMovieImages))
+
+	router.HandlerFunc(http.MethodPost, "/api/v1/movies/:id/images", app.requirePermission("movies:write", app.handleUploadMovieImage))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/movies/:id/images/:image_id", app.requirePermission("movies:write", app.handleDeleteMovieImage))
+
+	if files, ok := app.storage.(http.Handler); ok {
+		router.Handler(http.MethodGet, "/api/v1/images/*filepath", files)
+	}
+
+	// Credits routes
+	router.HandlerFunc(http.MethodGet, "/api/v1/movies/:id/credits", app.requirePermission("movies:read", app.handleShowMovieCredits))
+
+	router.HandlerFunc(http.MethodPost, "/api/v1/movies/:id/credits", app.requirePermission("movies:write", app.handleCreateMovieCredit))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/movies/:id/credits/:credit_id", app.requirePermission("movies:write", app.handleDeleteMovieCredit))
+
+	// Reviews routes
+	router.HandlerFunc(http.MethodGet, "/api/v1/movies/:id/reviews", app.requirePermission("movies:read", app.handleShowAllReviews))
+	router.HandlerFunc(http.MethodGet, "/api/v1/movies/:id/reviews/:review_id", app.requirePermission("movies:read", app.handleShowReview))
+
+	router.HandlerFunc(http.MethodPost, "/api/v1/movies/:id/reviews", app.requirePermission("reviews:write", app.handleCreateReview))
+
+	router.HandlerFunc(http.MethodPatch, "/api/v1/movies/:id/reviews/:review_id/edit", app.requirePermission("reviews:write", app.handleUpdateReview))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/movies/:id/reviews/:review_id/delete", app.requirePermission("reviews:write", app.handleDeleteReview))
+
+	// Comments routes
+	router.HandlerFunc(http.MethodGet, "/api/v1/movies/:id/comments", app.requirePermission("movies:read", app.handleShowAllComments))
+	router.HandlerFunc(http.MethodGet, "/api/v1/movies/:id/comments/:comment_id", app.requirePermission("movies:read", app.handleShowComment))
+	router.HandlerFunc(http.MethodGet, "/api/v1/movies/:id/comments/:comment_id/replies", app.requirePermission("movies:read", app.handleShowCommentReplies))
+
+	router.HandlerFunc(http.MethodPost, "/api/v1/movies/:id/comments", app.requirePermission("comments:write", app.handleCreateComment))
+
+	router.HandlerFunc(http.MethodPatch, "/api/v1/movies/:id/comments/:comment_id/edit", app.requirePermission("comments:write", app.handleUpdateComment))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/movies/:id/comments/:comment_id/delete", app.requirePermission("comments:write", app.handleDeleteComment))
+
+	router.HandlerFunc(http.MethodPut, "/api/v1/movies/:id/comments/:comment_id/hide", app.requirePermission("comments:moderate", app.handleHideComment))
+
+	// People routes
+	router.HandlerFunc(http.MethodGet, "/api/v1/people/:id", app.requirePermission("movies:read", app.handleShowPerson))
+	router.HandlerFunc(http.MethodGet, "/api/v1/people/:id/filmography", app.requirePermission("movies:read", app.handleShowFilmography))
+
+	router.HandlerFunc(http.MethodPost, "/api/v1/people", app.requirePermission("movies:write", app.handleCreatePerson))
+
+	router.HandlerFunc(http.MethodPatch, "/api/v1/people/:id/edit", app.requirePermission("movies:write", app.handleUpdatePerson))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/people/:id/delete", app.requirePermission("movies:write", app.handleDeletePerson))
+
 	// Users routes
 	router.HandlerFunc(http.MethodPost, "/api/v1/users/register", app.handleUserRegister)
 
 	router.HandlerFunc(http.MethodPut, "/api/v1/users/activate", app.handleActivateUser)
 
+	// Sessions routes
+	router.HandlerFunc(http.MethodGet, "/api/v1/users/me/sessions", app.requireFirstPartySession(app.handleShowSessions))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/users/me/sessions", app.requireFirstPartySession(app.handleDeleteAllSessions))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/users/me/sessions/:id", app.requireFirstPartySession(app.handleDeleteSession))
+
+	// API keys routes, keys are managed from a login, a key can't be used to mint others
+	router.HandlerFunc(http.MethodGet, "/api/v1/users/me/api-keys", app.requireActivatedUser(app.requireFirstPartySession(app.handleShowAPIKeys)))
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/me/api-keys", app.requireActivatedUser(app.requireFirstPartySession(app.handleCreateAPIKey)))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/users/me/api-keys/:id", app.requireActivatedUser(app.requireFirstPartySession(app.handleDeleteAPIKey)))
+
+	// OAuth clients routes
+	router.HandlerFunc(http.MethodGet, "/api/v1/oauth/clients", app.requireActivatedUser(app.requireFirstPartySession(app.handleShowOAuthClients)))
+	router.HandlerFunc(http.MethodPost, "/api/v1/oauth/clients", app.requireActivatedUser(app.requireFirstPartySession(app.handleCreateOAuthClient)))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/oauth/clients/:id", app.requireActivatedUser(app.requireFirstPartySession(app.handleDeleteOAuthClient)))
+
+	// Watchlist routes
+	router.HandlerFunc(http.MethodGet, "/api/v1/users/me/watchlist", app.requirePermission("watchlist:read", app.handleShowWatchlist))
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/me/watchlist", app.requirePermission("watchlist:write", app.handleAddToWatchlist))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/users/me/watchlist/:id", app.requirePermission("watchlist:write", app.handleRemoveFromWatchlist))
+
+	// History routes
+	router.HandlerFunc(http.MethodGet, "/api/v1/users/me/history", app.requirePermission("watchlist:read", app.handleShowHistory))
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/me/history", app.requirePermission("watchlist:write", app.handleAddToHistory))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/users/me/history/:id", app.requirePermission("watchlist:write", app.handleRemoveFromHistory))
+
 	// Tokens routes
 	router.HandlerFunc(http.MethodPost, "/api/v1/tokens/auth", app.handleCreateAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/api/v1/tokens/refresh", app.handleRefreshToken)
+	router.HandlerFunc(http.MethodDelete, "/api/v1/tokens/auth", app.requireAuthenticatedUser(app.handleDeleteAuthenticationToken))
 
 	router.HandlerFunc(http.MethodPost, "/api/v1/tokens/activation/new", app.handleResendActivationToken)
 
@@ -38,5 +139,26 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodPut, "/api/v1/tokens/password-reset", app.handleUpdatePassword)
 
+	// OAuth routes
+	router.HandlerFunc(http.MethodGet, "/oauth/authorize", app.requireActivatedUser(app.requireFirstPartySession(app.handleShowAuthorization)))
+	router.HandlerFunc(http.MethodPost, "/oauth/authorize", app.requireActivatedUser(app.requireFirstPartySession(app.handleAuthorize)))
+	router.HandlerFunc(http.MethodPost, "/oauth/token", app.handleOAuthToken)
+
 	return app.recoverPanic(app.rateLimit(app.authenticate(router)))
 }
+
+// dispatchStatic serves the static path segments that share a position
+// with the :id parameter, which httprouter can't register side by side,
+// every other value is passed to fallback
+func (app *application) dispatchStatic(routes map[string]http.HandlerFunc, fallback http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if next, ok := routes[params.ByName("id")]; ok {
+			next(w, r)
+			return
+		}
+
+		fallback(w, r)
+	}
+}
@@ -23,6 +23,11 @@ func (app *application) serve() error {
 	}
 
 	shutdownError := make(chan error)
+	stop := make(chan struct{})
+
+	app.background(func() {
+		app.purge(stop)
+	})
 
 	go func() {
 		quit := make(chan os.Signal, 1)
@@ -44,6 +49,8 @@ func (app *application) serve() error {
 			"addr": srv.Addr,
 		})
 
+		close(stop)
+
 		app.wg.Wait()
 		shutdownError <- nil
 	}()
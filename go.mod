@@ -8,9 +8,9 @@ require github.com/lib/pq v1.10.9
 
 require golang.org/x/time v0.5.0
 
-require golang.org/x/crypto v0.23.0
-
 require (
-	github.com/go-mail/mail/v2 v2.3.0 // indirect
-	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
+	github.com/go-mail/mail/v2 v2.3.0
+	golang.org/x/crypto v0.23.0
 )
+
+require gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
@@ -0,0 +1,88 @@
+package catalog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yousifsabah0/blackbox/internal/data"
+)
+
+func TestRoundTrip(t *testing.T) {
+	movies := []*data.Movie{
+		{ID: 1, Title: "Casablanca", Year: 1942, Runtime: 102, Genres: []string{"drama", "romance"}, Version: 3, CreatedAt: time.Now(), AverageScore: 4.5, ReviewCount: 2},
+		{ID: 2, Title: "Heat, the \"remake\"", Year: 1995, Runtime: 170, Genres: []string{"crime"}, Version: 1, CreatedAt: time.Now()},
+	}
+
+	for _, format := range Formats {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			writer, err := NewWriter(&buf, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, movie := range movies {
+				if err := writer.Write(movie); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := writer.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			reader, err := NewReader(&buf, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range movies {
+				record, err := reader.Read()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if record.Err != nil {
+					t.Fatalf("line %d: %v", record.Line, record.Err)
+				}
+
+				got := record.Movie
+				if got.Title != want.Title || got.Year != want.Year || got.Runtime != want.Runtime || !reflect.DeepEqual(got.Genres, want.Genres) {
+					t.Errorf("got %+v, want %+v", got, want)
+				}
+			}
+
+			if _, err := reader.Read(); !errors.Is(err, io.EOF) {
+				t.Errorf("got %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestNDJSONRejectsUnknownFields(t *testing.T) {
+	reader, err := NewReader(strings.NewReader(`{"title": "Heat", "year": 1995, "runtime": "170 mins", "genres": ["crime"], "review_count": 3}`), FormatNDJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if record.Err == nil {
+		t.Error("expected an error for the unknown field")
+	}
+}
+
+func TestCSVRejectsUnknownColumns(t *testing.T) {
+	if _, err := NewReader(strings.NewReader("title,year,runtime,genres,rating\n"), FormatCSV); err == nil {
+		t.Error("expected an error for the unknown column")
+	}
+}
@@ -0,0 +1,210 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/yousifsabah0/blackbox/internal/data"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+
+	// genreSeparator separates the genres inside the CSV genres column
+	genreSeparator = "|"
+
+	maxLineBytes = 1_048_576
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown catalog format")
+
+	Formats = []string{FormatCSV, FormatNDJSON}
+
+	columns = []string{"title", "year", "runtime", "genres"}
+)
+
+// Record is a single decoded row of a catalog file, Err is set when the
+// row could not be decoded into a movie
+type Record struct {
+	Line  int
+	Movie *data.Movie
+	Err   error
+}
+
+// Reader decodes catalog rows one at a time, Read returns io.EOF once
+// every row has been read
+type Reader interface {
+	Read() (*Record, error)
+}
+
+func NewReader(r io.Reader, format string) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+
+		return &ndjsonReader{scanner: scanner}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+type csvReader struct {
+	reader *csv.Reader
+	index  map[string]int
+	fields int
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("csv must start with a header row")
+		}
+
+		return nil, err
+	}
+
+	index := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !validator.In(name, exportColumns...) {
+			return nil, fmt.Errorf("csv header contains unknown column %q", name)
+		}
+
+		// columns written by the export but not read back are ignored
+		if !validator.In(name, columns...) {
+			continue
+		}
+
+		index[name] = i
+	}
+
+	for _, name := range columns {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("csv header is missing the %q column", name)
+		}
+	}
+
+	return &csvReader{reader: reader, index: index, fields: len(header)}, nil
+}
+
+func (c *csvReader) Read() (*Record, error) {
+	fields, err := c.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return &Record{Line: parseErr.StartLine, Err: parseErr.Err}, nil
+		}
+
+		return nil, err
+	}
+
+	line, _ := c.reader.FieldPos(0)
+	record := &Record{Line: line}
+
+	if len(fields) != c.fields {
+		record.Err = fmt.Errorf("expected %d fields, got %d", c.fields, len(fields))
+		return record, nil
+	}
+
+	movie := &data.Movie{
+		Title: fields[c.index["title"]],
+	}
+
+	year, err := strconv.ParseInt(strings.TrimSpace(fields[c.index["year"]]), 10, 32)
+	if err != nil {
+		record.Err = errors.New("year must be an integer value")
+		return record, nil
+	}
+	movie.Year = int32(year)
+
+	runtime := strings.TrimSuffix(strings.TrimSpace(fields[c.index["runtime"]]), " mins")
+	minutes, err := strconv.ParseInt(runtime, 10, 32)
+	if err != nil {
+		record.Err = data.ErrInvalidRuntimeFormat
+		return record, nil
+	}
+	movie.Runtime = data.Runtime(minutes)
+
+	movie.Genres = []string{}
+	for _, genre := range strings.Split(fields[c.index["genres"]], genreSeparator) {
+		if genre = strings.TrimSpace(genre); genre != "" {
+			movie.Genres = append(movie.Genres, genre)
+		}
+	}
+
+	record.Movie = movie
+
+	return record, nil
+}
+
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (n *ndjsonReader) Read() (*Record, error) {
+	for n.scanner.Scan() {
+		n.line++
+
+		text := bytes.TrimSpace(n.scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		// the fields written by the export but not read back are ignored,
+		// like the CSV columns
+		var input struct {
+			Title   string       `json:"title"`
+			Year    int32        `json:"year"`
+			Runtime data.Runtime `json:"runtime"`
+			Genres  []string     `json:"genres"`
+
+			ID        json.RawMessage `json:"id"`
+			Version   json.RawMessage `json:"version"`
+			CreatedAt json.RawMessage `json:"created_at"`
+		}
+
+		record := &Record{Line: n.line}
+
+		decoder := json.NewDecoder(bytes.NewReader(text))
+		decoder.DisallowUnknownFields()
+
+		if err := decoder.Decode(&input); err != nil {
+			record.Err = err
+			return record, nil
+		}
+
+		record.Movie = &data.Movie{
+			Title:   input.Title,
+			Year:    input.Year,
+			Runtime: input.Runtime,
+			Genres:  input.Genres,
+		}
+
+		return record, nil
+	}
+
+	if err := n.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
@@ -0,0 +1,113 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yousifsabah0/blackbox/internal/data"
+)
+
+var (
+	exportColumns = []string{"id", "title", "year", "runtime", "genres", "version", "created_at"}
+)
+
+// Writer encodes movies one at a time, Flush must be called once
+// writing is done
+type Writer interface {
+	Write(movie *data.Movie) error
+	Flush() error
+}
+
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{writer: csv.NewWriter(w)}, nil
+	case FormatNDJSON:
+		return &ndjsonWriter{encoder: json.NewEncoder(w)}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// ContentType returns the media type of the given format
+func ContentType(format string) string {
+	if format == FormatCSV {
+		return "text/csv"
+	}
+
+	return "application/x-ndjson"
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+	header bool
+}
+
+func (c *csvWriter) Write(movie *data.Movie) error {
+	if !c.header {
+		if err := c.writer.Write(exportColumns); err != nil {
+			return err
+		}
+
+		c.header = true
+	}
+
+	return c.writer.Write([]string{
+		strconv.FormatInt(movie.ID, 10),
+		movie.Title,
+		strconv.Itoa(int(movie.Year)),
+		strconv.Itoa(int(movie.Runtime)),
+		strings.Join(movie.Genres, genreSeparator),
+		strconv.Itoa(int(movie.Version)),
+		movie.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	if !c.header {
+		if err := c.writer.Write(exportColumns); err != nil {
+			return err
+		}
+
+		c.header = true
+	}
+
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+// ndjsonRecord holds the export columns of a movie, the same ones the CSV
+// export writes, so exports can be imported back
+type ndjsonRecord struct {
+	ID        int64        `json:"id"`
+	Title     string       `json:"title"`
+	Year      int32        `json:"year"`
+	Runtime   data.Runtime `json:"runtime"`
+	Genres    []string     `json:"genres"`
+	Version   int32        `json:"version"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+func (n *ndjsonWriter) Write(movie *data.Movie) error {
+	return n.encoder.Encode(ndjsonRecord{
+		ID:        movie.ID,
+		Title:     movie.Title,
+		Year:      movie.Year,
+		Runtime:   movie.Runtime,
+		Genres:    movie.Genres,
+		Version:   movie.Version,
+		CreatedAt: movie.CreatedAt,
+	})
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return nil
+}
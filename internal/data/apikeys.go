@@ -0,0 +1,252 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+const (
+	// APIKeyPrefix starts every api key, so leaked keys are easy to spot
+	APIKeyPrefix = "bbk_"
+
+	// apiKeyDisplayLength is how much of a key is kept in clear to tell
+	// keys apart once they are created
+	apiKeyDisplayLength = len(APIKeyPrefix) + 8
+
+	// APIKeyTouchInterval is how stale the last use of a key may get
+	// before it's written again
+	APIKeyTouchInterval = time.Minute
+)
+
+// APIKey authenticates a service on behalf of its owner, with a subset of
+// the owner's permissions. Key is only set when the key is created, only
+// its hash is stored.
+type APIKey struct {
+	ID     int64  `json:"id"`
+	UserID int64  `json:"-"`
+	Key    string `json:"key,omitempty"`
+	Hash   []byte `json:"-"`
+
+	Name        string      `json:"name"`
+	Prefix      string      `json:"prefix"`
+	Permissions Permissions `json:"permissions"`
+
+	Expiry    *time.Time `json:"expiry,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+}
+
+// Stale reports whether the last use of the key is due for a write
+func (k *APIKey) Stale() bool {
+	return k.LastUsedAt == nil || time.Since(*k.LastUsedAt) > APIKeyTouchInterval
+}
+
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+func ValidAPIKeyText(v *validator.Validator, text string) {
+	v.Check(strings.HasPrefix(text, APIKeyPrefix), "key", "must be a valid api key")
+	v.Check(len(text) == len(APIKeyPrefix)+32, "key", "must be a valid api key")
+}
+
+// New generates the key and stores its hash
+func (m APIKeyModel) New(key *APIKey) error {
+	randomBytes := make([]byte, 20)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return err
+	}
+
+	key.Key = APIKeyPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	key.Prefix = key.Key[:apiKeyDisplayLength]
+
+	hash := sha256.Sum256([]byte(key.Key))
+	key.Hash = hash[:]
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					INSERT INTO api_keys
+					(user_id, name, prefix, hash, permissions, expiry)
+					VALUES
+					($1, $2, $3, $4, $5, $6)
+					RETURNING id, created_at
+	`
+	args := []any{key.UserID, key.Name, key.Prefix, key.Hash, pq.Array([]string(key.Permissions)), key.Expiry}
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+}
+
+// GetForKey returns the owner of an api key along with the key. The key's
+// permissions are narrowed down to the ones its owner still holds.
+func (m APIKeyModel) GetForKey(text string) (*User, *APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var user User
+	var key APIKey
+
+	hash := sha256.Sum256([]byte(text))
+
+	query := `
+					SELECT
+					users.id, users.name, users.email, users.password_hash, users.activated, users.created_at, users.version,
+					api_keys.id, api_keys.name, api_keys.prefix, api_keys.expiry, api_keys.created_at, api_keys.last_used_at, api_keys.last_used_ip,
+					ARRAY(
+						SELECT permissions.code FROM permissions
+						INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+						WHERE users_permissions.user_id = users.id AND permissions.code = ANY(api_keys.permissions)
+					)
+					FROM users
+					INNER JOIN api_keys
+					ON users.id = api_keys.user_id
+					WHERE
+					api_keys.hash = $1 AND
+					(api_keys.expiry IS NULL OR api_keys.expiry > $2)
+	`
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:], time.Now()).Scan(
+		&user.ID,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.CreatedAt,
+		&user.Version,
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&key.Expiry,
+		&key.CreatedAt,
+		&key.LastUsedAt,
+		&key.LastUsedIP,
+		pq.Array((*[]string)(&key.Permissions)),
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, ErrRecordNotFound
+		}
+
+		return nil, nil, err
+	}
+
+	key.UserID = user.ID
+
+	return &user, &key, nil
+}
+
+func (m APIKeyModel) SelectAllForUser(userID int64) ([]*APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					SELECT id, user_id, name, prefix, permissions, expiry, created_at, last_used_at, last_used_ip
+					FROM api_keys
+					WHERE
+					user_id = $1
+					ORDER BY id ASC
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		var key APIKey
+		err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array((*[]string)(&key.Permissions)),
+			&key.Expiry,
+			&key.CreatedAt,
+			&key.LastUsedAt,
+			&key.LastUsedIP,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &key)
+	}
+
+	return keys, rows.Err()
+}
+
+// Touch records a use of the key, it's a no-op when the key was used
+// recently enough
+func (m APIKeyModel) Touch(id int64, ip string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					UPDATE api_keys
+					SET
+					last_used_at = NOW(), last_used_ip = $2
+					WHERE
+					id = $1 AND (last_used_at IS NULL OR last_used_at < $3)
+	`
+	args := []any{id, ip, time.Now().Add(-APIKeyTouchInterval)}
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// Delete revokes the key of the user
+func (m APIKeyModel) Delete(userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ValidateAPIKey checks the key against the permissions of its owner, a
+// key can't be granted more than its owner holds
+func ValidateAPIKey(v *validator.Validator, key *APIKey, owner Permissions) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(key.Permissions) > 0, "permissions", "must contain at least 1 permission")
+	v.Check(validator.Unique(key.Permissions), "permissions", "must not contain duplicate values")
+
+	for _, permission := range key.Permissions {
+		v.Check(owner.Contains(permission), "permissions", fmt.Sprintf("%q is not one of your permissions", permission))
+	}
+
+	v.Check(key.Expiry == nil || key.Expiry.After(time.Now()), "expiry", "must be in the future")
+}
@@ -0,0 +1,96 @@
+package data
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+func TestValidateAPIKey(t *testing.T) {
+	owner := Permissions{"movies:read", "movies:write"}
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name  string
+		key   APIKey
+		field string
+	}{
+		{"valid", APIKey{Name: "ci", Permissions: Permissions{"movies:read"}}, ""},
+		{"all of the owner's permissions", APIKey{Name: "ci", Permissions: Permissions{"movies:read", "movies:write"}}, ""},
+		{"no name", APIKey{Permissions: Permissions{"movies:read"}}, "name"},
+		{"no permissions", APIKey{Name: "ci"}, "permissions"},
+		{"duplicate permissions", APIKey{Name: "ci", Permissions: Permissions{"movies:read", "movies:read"}}, "permissions"},
+		{"more than the owner holds", APIKey{Name: "ci", Permissions: Permissions{"movies:read", "comments:moderate"}}, "permissions"},
+		{"expired", APIKey{Name: "ci", Permissions: Permissions{"movies:read"}, Expiry: &past}, "expiry"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateAPIKey(v, &tt.key, owner)
+
+			if tt.field == "" {
+				if !v.Valid() {
+					t.Errorf("got errors %v", v.Errors)
+				}
+				return
+			}
+
+			if _, ok := v.Errors[tt.field]; !ok {
+				t.Errorf("got errors %v, want one for %s", v.Errors, tt.field)
+			}
+		})
+	}
+}
+
+func TestAPIKeyGetForKey(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := APIKeyModel{DB: db}
+
+	now := time.Now()
+	columns := []string{"id", "name", "email", "password_hash", "activated", "created_at", "version", "id", "name", "prefix", "expiry", "created_at", "last_used_at", "last_used_ip", "array"}
+
+	// the key's permissions come back narrowed down to the ones its owner
+	// still holds, movies:write was revoked since the key was created
+	f.expect("permissions.code = ANY(api_keys.permissions)").returns(columns, []driver.Value{
+		int64(2), "alice", "alice@example.com", []byte("hash"), true, now, int64(1),
+		int64(7), "ci", "bbk_ABCDEFGH", nil, now, nil, "", []byte("{movies:read}"),
+	})
+	f.expect("FROM users").returns(columns)
+
+	user, key, err := m.GetForKey("bbk_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.ID != 2 || key.ID != 7 || key.UserID != 2 {
+		t.Errorf("got user %+v, key %+v", user, key)
+	}
+
+	if len(key.Permissions) != 1 || !key.Permissions.Contains("movies:read") {
+		t.Errorf("got permissions %v, want [movies:read]", key.Permissions)
+	}
+
+	if _, _, err := m.GetForKey("bbk_unknown"); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("unknown key: got %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestAPIKeyDelete(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := APIKeyModel{DB: db}
+
+	f.expect("DELETE FROM api_keys").affects(0)
+
+	// another user's key isn't theirs to delete
+	if err := m.Delete(3, 7); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got %v, want ErrRecordNotFound", err)
+	}
+
+	if err := m.Delete(2, 0); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("invalid id: got %v, want ErrRecordNotFound", err)
+	}
+}
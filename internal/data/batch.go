@@ -0,0 +1,122 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// batchTimeout is kept under the server's 30 seconds write timeout, so
+	// the client still gets the outcome of a batch that runs out of time
+	batchTimeout = 25 * time.Second
+)
+
+// MovieBatch runs several movie changes in a single transaction on
+// behalf of a user. Each change runs in its own savepoint through Do, so
+// a failing change can be undone without losing the others.
+type MovieBatch struct {
+	tx     *sql.Tx
+	ctx    context.Context
+	cancel context.CancelFunc
+	userID int64
+}
+
+func (m MovieModel) Batch(userID int64) (*MovieBatch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), batchTimeout)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &MovieBatch{tx: tx, ctx: ctx, cancel: cancel, userID: userID}, nil
+}
+
+// Do runs fn inside a savepoint, everything fn did is rolled back when it
+// returns an error, which is then returned as is
+func (b *MovieBatch) Do(fn func() error) error {
+	if _, err := b.tx.ExecContext(b.ctx, "SAVEPOINT movie_batch"); err != nil {
+		return err
+	}
+
+	if err := fn(); err != nil {
+		if _, rollbackErr := b.tx.ExecContext(b.ctx, "ROLLBACK TO SAVEPOINT movie_batch"); rollbackErr != nil {
+			return rollbackErr
+		}
+
+		return err
+	}
+
+	_, err := b.tx.ExecContext(b.ctx, "RELEASE SAVEPOINT movie_batch")
+	return err
+}
+
+// Select locks the movie until the batch ends
+func (b *MovieBatch) Select(id int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	var movie Movie
+
+	query := `
+					SELECT id, title, year, runtime, genres, version, created_at
+					FROM movies
+					WHERE
+					id = $1 AND deleted_at IS NULL
+					FOR UPDATE
+	`
+
+	err := b.tx.QueryRowContext(b.ctx, query, id).Scan(
+		&movie.ID,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+		&movie.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return &movie, nil
+}
+
+func (b *MovieBatch) Insert(movie *Movie) error {
+	return insertMovie(b.ctx, b.tx, movie, b.userID)
+}
+
+func (b *MovieBatch) Update(movie *Movie) error {
+	return updateMovie(b.ctx, b.tx, movie, b.userID)
+}
+
+func (b *MovieBatch) Delete(id int64, version int32) error {
+	return deleteMovieVersion(b.ctx, b.tx, id, version)
+}
+
+func (b *MovieBatch) Commit() error {
+	defer b.cancel()
+	return b.tx.Commit()
+}
+
+// Rollback discards the whole batch, it's a no-op once the batch is
+// committed
+func (b *MovieBatch) Rollback() error {
+	defer b.cancel()
+
+	if err := b.tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package data
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMovieBatch(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := MovieModel{DB: db}
+
+	// the insert is kept, the conflicting delete is undone on its own
+	f.expect("SAVEPOINT movie_batch")
+	f.expect("INSERT INTO movies").returns([]string{"id", "created_at", "version"}, []driver.Value{int64(5), time.Now(), int64(1)})
+	revision := f.expect("INSERT INTO movie_revisions")
+	f.expect("RELEASE SAVEPOINT movie_batch")
+	f.expect("SAVEPOINT movie_batch")
+	f.expect("id = $1 AND version = $2 AND deleted_at IS NULL").affects(0)
+	f.expect("ROLLBACK TO SAVEPOINT movie_batch")
+
+	batch, err := m.Batch(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer batch.Rollback()
+
+	movie := &Movie{Title: "Heat", Year: 1995, Runtime: 170, Genres: []string{"crime"}}
+	if err := batch.Do(func() error { return batch.Insert(movie) }); err != nil {
+		t.Fatal(err)
+	}
+
+	if movie.ID != 5 || movie.Version != 1 {
+		t.Errorf("got %+v", movie)
+	}
+
+	// the revision is recorded as the user's
+	if revision.args[6] != int64(2) {
+		t.Errorf("got revision by %v, want 2", revision.args[6])
+	}
+
+	if err := batch.Do(func() error { return batch.Delete(6, 1) }); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("got %v, want ErrEditConflict", err)
+	}
+
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// rolling back a committed batch is a no-op
+	if err := batch.Rollback(); err != nil {
+		t.Errorf("rollback after commit: got %v", err)
+	}
+
+	if f.commits != 1 || f.rollbacks != 0 {
+		t.Errorf("got %d commits and %d rollbacks, want 1 and 0", f.commits, f.rollbacks)
+	}
+}
+
+func TestMovieBatchSelect(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := MovieModel{DB: db}
+
+	f.expect("FOR UPDATE").returns([]string{"id", "title", "year", "runtime", "genres", "version", "created_at"})
+
+	batch, err := m.Batch(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := batch.Select(5); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got %v, want ErrRecordNotFound", err)
+	}
+
+	if _, err := batch.Select(0); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("invalid id: got %v, want ErrRecordNotFound", err)
+	}
+
+	if err := batch.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if f.rollbacks != 1 {
+		t.Errorf("got %d rollbacks, want 1", f.rollbacks)
+	}
+}
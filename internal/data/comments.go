@@ -0,0 +1,294 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+// Comment is a message of a movie's discussion, replies point to the
+// comment they answer through ParentID
+type Comment struct {
+	ID       int64  `json:"id"`
+	MovieID  int64  `json:"movie_id"`
+	ParentID *int64 `json:"parent_id,omitempty"`
+	UserID   int64  `json:"user_id,omitempty"`
+
+	Body    string `json:"body"`
+	Replies int    `json:"replies"`
+
+	Deleted bool `json:"deleted,omitempty"`
+	Hidden  bool `json:"hidden,omitempty"`
+
+	Version   int32     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MarshalJSON writes deleted and hidden comments as placeholders, they
+// keep their place in the thread but not their author or body
+func (comment *Comment) MarshalJSON() ([]byte, error) {
+	type plain Comment
+
+	c := *comment
+	if c.Deleted || c.Hidden {
+		c.UserID = 0
+		c.Body = ""
+	}
+
+	return json.Marshal((*plain)(&c))
+}
+
+type CommentModel struct {
+	DB *sql.DB
+}
+
+const commentColumns = `
+					id, movie_id, parent_id, user_id, body,
+					(SELECT count(*) FROM comments AS replies WHERE replies.parent_id = comments.id),
+					deleted_at IS NOT NULL, hidden_at IS NOT NULL,
+					version, created_at, updated_at
+`
+
+func (comment *Comment) targets() []any {
+	return []any{
+		&comment.ID,
+		&comment.MovieID,
+		&comment.ParentID,
+		&comment.UserID,
+		&comment.Body,
+		&comment.Replies,
+		&comment.Deleted,
+		&comment.Hidden,
+		&comment.Version,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+	}
+}
+
+func (m CommentModel) Insert(comment *Comment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					INSERT INTO comments
+					(movie_id, user_id, parent_id, body)
+					VALUES
+					($1, $2, $3, $4)
+					RETURNING id, version, created_at, updated_at
+	`
+	args := []any{comment.MovieID, comment.UserID, comment.ParentID, comment.Body}
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&comment.ID, &comment.Version, &comment.CreatedAt, &comment.UpdatedAt)
+}
+
+// Select returns the comment with the given id, scoped to a movie
+func (m CommentModel) Select(movieID, id int64) (*Comment, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	var comment Comment
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := fmt.Sprintf(`
+					SELECT
+					%s
+					FROM comments
+					WHERE
+					id = $1 AND movie_id = $2
+	`, commentColumns)
+
+	err := m.DB.QueryRowContext(ctx, query, id, movieID).Scan(comment.targets()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+// SelectThread returns a page of the direct replies to the parent comment,
+// or of the top level comments of the movie when parentID is 0. Pages are
+// always walked with a cursor as threads keep growing while being read.
+func (m CommentModel) SelectThread(movieID, parentID int64, filters Filters) ([]*Comment, MetaData, error) {
+	comments := []*Comment{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	condition, order, keysetArgs := filters.keyset(4)
+
+	query := fmt.Sprintf(`
+					SELECT
+					%s
+					FROM comments
+					WHERE
+					movie_id = $1
+					AND
+					(($2 = 0 AND parent_id IS NULL) OR parent_id = $2)
+					AND
+					%s
+					ORDER BY %s
+					LIMIT $3
+	`, commentColumns, condition, order)
+	args := append([]any{movieID, parentID, filters.limit() + 1}, keysetArgs...)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var comment Comment
+		if err := rows.Scan(comment.targets()...); err != nil {
+			return nil, MetaData{}, err
+		}
+
+		comments = append(comments, &comment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, MetaData{}, err
+	}
+
+	more := len(comments) > filters.limit()
+	if more {
+		comments = comments[:filters.limit()]
+	}
+
+	if c, _ := decodeCursor(filters.Cursor); filters.Cursor != "" && c.Prev {
+		slices.Reverse(comments)
+	}
+
+	if len(comments) == 0 {
+		return comments, MetaData{PageSize: filters.PageSize}, nil
+	}
+
+	first, last := comments[0], comments[len(comments)-1]
+
+	metadata := filters.keysetMetaData(
+		cursor{Values: []string{strconv.FormatInt(first.ID, 10)}},
+		cursor{Values: []string{strconv.FormatInt(last.ID, 10)}},
+		more,
+	)
+
+	return comments, metadata, nil
+}
+
+func (m CommentModel) Update(comment *Comment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					UPDATE comments
+					SET
+					body = $1, updated_at = NOW(), version = version + 1
+					WHERE
+					version = $2
+					AND
+					id = $3
+					AND
+					deleted_at IS NULL
+					RETURNING version, updated_at
+	`
+	args := []any{comment.Body, comment.Version, comment.ID}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&comment.Version, &comment.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Delete turns the comment into a placeholder, its replies stay in the
+// thread. The body is dropped since it can't be shown anymore.
+func (m CommentModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					UPDATE comments
+					SET
+					body = '', deleted_at = NOW(), version = version + 1
+					WHERE
+					id = $1 AND deleted_at IS NULL
+	`
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// SetHidden hides or shows back the comment on behalf of a moderator,
+// unlike Delete the body is kept so that hiding can be undone
+func (m CommentModel) SetHidden(comment *Comment, hidden bool, moderatorID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					UPDATE comments
+					SET
+					hidden_at = CASE WHEN $1 THEN NOW() END,
+					hidden_by = CASE WHEN $1 THEN $2::bigint END,
+					version = version + 1
+					WHERE
+					version = $3
+					AND
+					id = $4
+					RETURNING version
+	`
+	args := []any{hidden, moderatorID, comment.Version, comment.ID}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&comment.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+
+		return err
+	}
+
+	comment.Hidden = hidden
+
+	return nil
+}
+
+func ValidateComment(v *validator.Validator, comment *Comment) {
+	v.Check(comment.Body != "", "body", "must be provided")
+	v.Check(len(comment.Body) <= 10_000, "body", "must not be more than 10000 bytes long")
+}
@@ -0,0 +1,94 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+func TestCommentMarshalJSONHidesRemovedComments(t *testing.T) {
+	tests := []struct {
+		name     string
+		comment  Comment
+		wantBody bool
+	}{
+		{"visible", Comment{ID: 1, UserID: 2, Body: "hello"}, true},
+		{"deleted", Comment{ID: 1, UserID: 2, Body: "hello", Deleted: true}, false},
+		{"hidden", Comment{ID: 1, UserID: 2, Body: "hello", Hidden: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js, err := json.Marshal(&tt.comment)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got map[string]any
+			if err := json.Unmarshal(js, &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if shown := got["body"] == "hello" && got["user_id"] != nil; shown != tt.wantBody {
+				t.Errorf("got %s", js)
+			}
+
+			if tt.comment.Body != "hello" {
+				t.Error("marshaling modified the comment")
+			}
+		})
+	}
+}
+
+func TestCommentDelete(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := CommentModel{DB: db}
+
+	f.expect("deleted_at = NOW()").affects(1)
+	f.expect("deleted_at = NOW()").affects(0)
+
+	if err := m.Delete(4); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Delete(4); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("deleting twice: got %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestCommentSetHidden(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := CommentModel{DB: db}
+
+	f.expect("hidden_at = CASE").returns([]string{"version"}, []driver.Value{int64(3)})
+	f.expect("hidden_at = CASE").returns([]string{"version"})
+
+	comment := &Comment{ID: 4, Version: 2}
+	if err := m.SetHidden(comment, true, 9); err != nil {
+		t.Fatal(err)
+	}
+
+	if !comment.Hidden || comment.Version != 3 {
+		t.Errorf("got %+v", comment)
+	}
+
+	if err := m.SetHidden(&Comment{ID: 4, Version: 2}, true, 9); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("stale version: got %v, want ErrEditConflict", err)
+	}
+}
+
+func TestValidateComment(t *testing.T) {
+	for body, valid := range map[string]bool{
+		"":                           false,
+		"hello":                      true,
+		string(make([]byte, 10_001)): false,
+	} {
+		v := validator.New()
+		if ValidateComment(v, &Comment{Body: body}); v.Valid() != valid {
+			t.Errorf("%d bytes body: got valid %t", len(body), v.Valid())
+		}
+	}
+}
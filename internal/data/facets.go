@@ -0,0 +1,125 @@
+package data
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+const (
+	FacetGenres  = "genres"
+	FacetDecade  = "decade"
+	FacetRuntime = "runtime"
+
+	// runtimeBucketSize is the width, in minutes, of the runtime buckets
+	runtimeBucketSize = 30
+)
+
+var FacetNames = []string{FacetGenres, FacetDecade, FacetRuntime}
+
+// FacetCount is the number of movies sharing a facet value
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets maps each requested facet to its value counts
+type Facets map[string][]FacetCount
+
+// movieBucket groups the movies by an expression, label is the value a
+// group is reported as. The facets and the stats histograms share them so
+// both report the same buckets.
+type movieBucket struct {
+	label string
+	group string
+}
+
+var (
+	decadeBucket = movieBucket{
+		label: `((year / 10) * 10)::text || 's'`,
+		group: `year / 10`,
+	}
+
+	runtimeBucket = movieBucket{
+		label: fmt.Sprintf(`((runtime / %[1]d) * %[1]d)::text || '-' || ((runtime / %[1]d) * %[1]d + %[1]d - 1)::text || ' mins'`, runtimeBucketSize),
+		group: fmt.Sprintf(`runtime / %d`, runtimeBucketSize),
+	}
+)
+
+// query selects the label and the aggregates of each bucket, grouped over
+// the movies matching the search clause left to fill in
+func (b movieBucket) query(aggregates string) string {
+	return fmt.Sprintf(`
+				SELECT %s, %s
+				FROM movies
+				WHERE
+				%%s
+				GROUP BY %s
+				ORDER BY %s ASC
+	`, b.label, aggregates, b.group, b.group)
+}
+
+// facetQueries select a label and a count for each facet, grouped over
+// the movies matching the search clause
+var facetQueries = map[string]string{
+	FacetGenres: `
+				SELECT genre, count(*)
+				FROM movies
+				CROSS JOIN LATERAL unnest(genres) AS genre
+				WHERE
+				%s
+				GROUP BY genre
+				ORDER BY count(*) DESC, genre ASC
+	`,
+	FacetDecade:  decadeBucket.query("count(*)"),
+	FacetRuntime: runtimeBucket.query("count(*)"),
+}
+
+// Facets counts the movies matching the search per value of each of the
+// requested facets
+func (m MovieModel) Facets(search MovieSearch, names []string) (Facets, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	facets := make(Facets)
+
+	for _, name := range names {
+		query := fmt.Sprintf(facetQueries[name], search.clause())
+
+		rows, err := m.DB.QueryContext(ctx, query, search.args()...)
+		if err != nil {
+			return nil, err
+		}
+
+		counts := []FacetCount{}
+		for rows.Next() {
+			var count FacetCount
+			if err := rows.Scan(&count.Value, &count.Count); err != nil {
+				rows.Close()
+				return nil, err
+			}
+
+			counts = append(counts, count)
+		}
+
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		rows.Close()
+
+		facets[name] = counts
+	}
+
+	return facets, nil
+}
+
+func ValidateFacets(v *validator.Validator, names []string) {
+	for _, name := range names {
+		v.Check(validator.In(name, FacetNames...), "facets", fmt.Sprintf("unknown facet %q", name))
+	}
+
+	v.Check(validator.Unique(names), "facets", "must not contain duplicate values")
+}
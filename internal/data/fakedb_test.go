@@ -0,0 +1,190 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDB is a database/sql driver scripted with the statements a test
+// expects, in order, and what each of them answers. It lets the models be
+// tested without a database.
+type fakeDB struct {
+	t *testing.T
+
+	mu        sync.Mutex
+	expected  []*expectation
+	commits   int
+	rollbacks int
+}
+
+// expectation is a statement the model is expected to run, query only has
+// to be a part of it
+type expectation struct {
+	query string
+
+	columns  []string
+	rows     [][]driver.Value
+	affected int64
+	err      error
+
+	// args are the arguments the statement was run with
+	args []driver.Value
+	done bool
+}
+
+func newFakeDB(t *testing.T) (*sql.DB, *fakeDB) {
+	f := &fakeDB{t: t}
+
+	db := sql.OpenDB(f)
+	t.Cleanup(func() {
+		db.Close()
+
+		for _, e := range f.expected {
+			if !e.done {
+				t.Errorf("statement %q was never run", e.query)
+			}
+		}
+	})
+
+	return db, f
+}
+
+func (f *fakeDB) expect(query string) *expectation {
+	e := &expectation{query: query}
+	f.expected = append(f.expected, e)
+
+	return e
+}
+
+func (e *expectation) returns(columns []string, rows ...[]driver.Value) *expectation {
+	e.columns, e.rows = columns, rows
+	return e
+}
+
+func (e *expectation) affects(n int64) *expectation {
+	e.affected = n
+	return e
+}
+
+func (e *expectation) fails(err error) *expectation {
+	e.err = err
+	return e
+}
+
+// next matches query against the first expectation not run yet
+func (f *fakeDB) next(query string, args []driver.NamedValue) (*expectation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, e := range f.expected {
+		if e.done {
+			continue
+		}
+
+		if !strings.Contains(query, e.query) {
+			break
+		}
+
+		e.done = true
+		for _, arg := range args {
+			e.args = append(e.args, arg.Value)
+		}
+
+		return e, e.err
+	}
+
+	f.t.Errorf("unexpected statement %q", strings.Join(strings.Fields(query), " "))
+	return nil, fmt.Errorf("unexpected statement")
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) {
+	return fakeConn{f}, nil
+}
+
+func (f *fakeDB) Driver() driver.Driver {
+	return nil
+}
+
+type fakeConn struct {
+	f *fakeDB
+}
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepared statements aren't supported")
+}
+
+func (c fakeConn) Close() error {
+	return nil
+}
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{c.f}, nil
+}
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	e, err := c.f.next(query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fakeRows{columns: e.columns, rows: e.rows}, nil
+}
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, err := c.f.next(query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(e.affected), nil
+}
+
+type fakeTx struct {
+	f *fakeDB
+}
+
+func (tx fakeTx) Commit() error {
+	tx.f.mu.Lock()
+	defer tx.f.mu.Unlock()
+
+	tx.f.commits++
+	return nil
+}
+
+func (tx fakeTx) Rollback() error {
+	tx.f.mu.Lock()
+	defer tx.f.mu.Unlock()
+
+	tx.f.rollbacks++
+	return nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+
+	return nil
+}
@@ -1,6 +1,9 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"math"
 	"strings"
 
@@ -13,6 +16,9 @@ type MetaData struct {
 	FirstPage   int `json:"first_page"`
 	LastPage    int `json:"last_page"`
 	Total       int `json:"total"`
+
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
 }
 
 func calculateMetaData(total, page, pageSize int) MetaData {
@@ -35,23 +41,110 @@ type Filters struct {
 	PageSize     int
 	Sort         string
 	SortSafeList []string
+
+	// Keyset switches the listing to cursor pagination, Cursor holds the
+	// opaque position to continue from and is empty for the first page
+	Keyset bool
+	Cursor string
+}
+
+// cursor is the decoded form of the opaque pagination cursor, it holds
+// the value of every sort key, id included, of the row to seek past
+type cursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+	Prev   bool     `json:"p,omitempty"`
+}
+
+// sortKey is one of the comma separated keys of a sort parameter
+type sortKey struct {
+	column    string
+	direction string
+}
+
+func encodeCursor(c cursor) string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, err
+	}
+
+	if err := json.Unmarshal(js, &c); err != nil {
+		return cursor{}, err
+	}
+
+	return c, nil
 }
 
-func (f Filters) sortColumn() string {
-	for _, value := range f.SortSafeList {
-		if f.Sort == value {
-			return strings.TrimPrefix(f.Sort, "-")
+// sortKeys splits the sort parameter into its keys, "-year,title" sorts
+// by year descending and then by title
+func (f Filters) sortKeys() []string {
+	keys := strings.Split(f.Sort, ",")
+	for i := range keys {
+		keys[i] = strings.TrimSpace(keys[i])
+	}
+
+	return keys
+}
+
+// sortOrder returns the sort keys followed by the id tiebreak, unless id is
+// already one of the keys
+func (f Filters) sortOrder() []sortKey {
+	var order []sortKey
+
+	for _, key := range f.sortKeys() {
+		if !validator.In(key, f.SortSafeList...) {
+			panic("unsafe sort parameter: " + key)
+		}
+
+		direction := "ASC"
+		if strings.HasPrefix(key, "-") {
+			direction = "DESC"
+		}
+
+		order = append(order, sortKey{column: strings.TrimPrefix(key, "-"), direction: direction})
+	}
+
+	for _, key := range order {
+		if key.column == "id" {
+			return order
 		}
 	}
-	panic("unsafe sort parameter: " + f.Sort)
+
+	return append(order, sortKey{column: "id", direction: "ASC"})
 }
 
-func (f Filters) sortDirection() string {
-	if strings.HasPrefix(f.Sort, "-") {
-		return "DESC"
+// sortColumns returns the columns of sortOrder
+func (f Filters) sortColumns() []string {
+	var columns []string
+	for _, key := range f.sortOrder() {
+		columns = append(columns, key.column)
 	}
 
-	return "ASC"
+	return columns
+}
+
+// orderBy returns the ORDER BY clause of the sort, it ends with a stable
+// tiebreak on the given id column
+func (f Filters) orderBy(tiebreak string) string {
+	var clauses []string
+
+	for _, key := range f.sortOrder() {
+		column := key.column
+		if column == "id" {
+			column = tiebreak
+		}
+
+		clauses = append(clauses, column+" "+key.direction)
+	}
+
+	return strings.Join(clauses, ", ")
 }
 
 func (f Filters) limit() int {
@@ -62,12 +155,114 @@ func (f Filters) offset() int {
 	return (f.Page - 1) * f.PageSize
 }
 
+// keyset returns the condition that seeks past the cursor and the matching
+// ORDER BY clause, placeholders are numbered starting at next. The
+// condition compares the sort keys one after the other, so every key can
+// have its own direction. When walking backwards every direction is
+// flipped and the rows must be reversed by the caller.
+func (f Filters) keyset(next int) (string, string, []any) {
+	order := f.sortOrder()
+
+	c, err := decodeCursor(f.Cursor)
+	if err != nil || f.Cursor == "" {
+		return "true", f.orderBy("id"), nil
+	}
+
+	if c.Prev {
+		for i := range order {
+			order[i].direction = flipDirection(order[i].direction)
+		}
+	}
+
+	var clauses, orderBy []string
+	var args []any
+
+	for i, key := range order {
+		var parts []string
+		for _, previous := range order[:i] {
+			parts = append(parts, fmt.Sprintf("%s = $%d", previous.column, next+len(parts)))
+		}
+		parts = append(parts, fmt.Sprintf("%s %s $%d", key.column, comparison(key.direction), next+i))
+
+		clauses = append(clauses, "("+strings.Join(parts, " AND ")+")")
+		orderBy = append(orderBy, key.column+" "+key.direction)
+		args = append(args, c.Values[i])
+	}
+
+	return "(" + strings.Join(clauses, " OR ") + ")", strings.Join(orderBy, ", "), args
+}
+
+// keysetMetaData builds the cursors around a page of rows fetched with
+// keyset, more reports whether a row beyond the page was found
+func (f Filters) keysetMetaData(first, last cursor, more bool) MetaData {
+	metadata := MetaData{PageSize: f.PageSize}
+
+	c, _ := decodeCursor(f.Cursor)
+	backwards := f.Cursor != "" && c.Prev
+
+	first.Sort, last.Sort = f.Sort, f.Sort
+	first.Prev = true
+
+	if more || backwards {
+		metadata.NextCursor = encodeCursor(last)
+	}
+
+	if (f.Cursor != "" && !backwards) || (backwards && more) {
+		metadata.PrevCursor = encodeCursor(first)
+	}
+
+	return metadata
+}
+
+func flipDirection(direction string) string {
+	if direction == "ASC" {
+		return "DESC"
+	}
+
+	return "ASC"
+}
+
+func comparison(direction string) string {
+	if direction == "ASC" {
+		return ">"
+	}
+
+	return "<"
+}
+
 func ValidateFilters(v *validator.Validator, f Filters) {
-	v.Check(f.Page > 0, "page", "must be greater than 0")
-	v.Check(f.Page < 10_000_000, "page", "must be less than 10_000_000")
+	if f.Keyset {
+		v.Check(f.PageSize > 0, "limit", "must be greater than 0")
+		v.Check(f.PageSize <= 100, "limit", "must be a maximum of 100")
+	} else {
+		v.Check(f.Page > 0, "page", "must be greater than 0")
+		v.Check(f.Page < 10_000_000, "page", "must be less than 10_000_000")
 
-	v.Check(f.Page > 0, "page_size", "must be greater than 0")
-	v.Check(f.Page < 100, "page_size", "must be less than 100")
+		v.Check(f.PageSize > 0, "page_size", "must be greater than 0")
+		v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
+	}
 
-	v.Check(validator.In(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+	keys := f.sortKeys()
+	columns := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		if !validator.In(key, f.SortSafeList...) {
+			v.AddErrors("sort", fmt.Sprintf("invalid sort key %q", key))
+			continue
+		}
+
+		columns = append(columns, strings.TrimPrefix(key, "-"))
+	}
+
+	v.Check(validator.Unique(columns), "sort", "must not sort by the same column twice")
+
+	if f.Keyset && f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		v.Check(err == nil, "cursor", "must be a valid cursor")
+		v.Check(err != nil || c.Sort == f.Sort, "cursor", "does not match the sort parameter")
+
+		if err == nil && c.Sort == f.Sort && v.Valid() {
+			v.Check(len(c.Values) == len(f.sortOrder()), "cursor", "must be a valid cursor")
+		}
+	}
 }
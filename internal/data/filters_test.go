@@ -0,0 +1,126 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := cursor{Sort: "-year,title", Values: []string{"1999", "The Matrix", "42"}, Prev: true}
+
+	got, err := decodeCursor(encodeCursor(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if _, err := decodeCursor("not a cursor!"); err == nil {
+		t.Error("expected an error for a malformed cursor")
+	}
+}
+
+func TestKeyset(t *testing.T) {
+	safe := []string{"id", "title", "year", "-id", "-title", "-year"}
+
+	tests := []struct {
+		name      string
+		filters   Filters
+		condition string
+		order     string
+		args      []any
+	}{
+		{
+			name:      "first page",
+			filters:   Filters{Sort: "-year", SortSafeList: safe, Keyset: true},
+			condition: "true",
+			order:     "year DESC, id ASC",
+		},
+		{
+			name: "forwards",
+			filters: Filters{Sort: "-year,title", SortSafeList: safe, Keyset: true,
+				Cursor: encodeCursor(cursor{Sort: "-year,title", Values: []string{"1999", "Heat", "7"}})},
+			condition: "((year < $3) OR (year = $3 AND title > $4) OR (year = $3 AND title = $4 AND id > $5))",
+			order:     "year DESC, title ASC, id ASC",
+			args:      []any{"1999", "Heat", "7"},
+		},
+		{
+			name: "backwards",
+			filters: Filters{Sort: "title", SortSafeList: safe, Keyset: true,
+				Cursor: encodeCursor(cursor{Sort: "title", Values: []string{"Heat", "7"}, Prev: true})},
+			condition: "((title < $3) OR (title = $3 AND id < $4))",
+			order:     "title DESC, id DESC",
+			args:      []any{"Heat", "7"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition, order, args := tt.filters.keyset(3)
+
+			if condition != tt.condition {
+				t.Errorf("condition: got %q, want %q", condition, tt.condition)
+			}
+
+			if order != tt.order {
+				t.Errorf("order: got %q, want %q", order, tt.order)
+			}
+
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args: got %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestKeysetMetaDataRoundTrip(t *testing.T) {
+	safe := []string{"id", "title"}
+
+	first := cursor{Values: []string{"Alien", "1"}}
+	last := cursor{Values: []string{"Heat", "7"}}
+
+	metadata := Filters{Sort: "title", SortSafeList: safe, Keyset: true, PageSize: 2}.keysetMetaData(first, last, true)
+	if metadata.PrevCursor != "" {
+		t.Error("the first page must not have a previous cursor")
+	}
+
+	next := Filters{Sort: "title", SortSafeList: safe, Keyset: true, PageSize: 2, Cursor: metadata.NextCursor}
+
+	v := validator.New()
+	if ValidateFilters(v, next); !v.Valid() {
+		t.Fatalf("next cursor rejected: %v", v.Errors)
+	}
+
+	if _, _, args := next.keyset(1); !reflect.DeepEqual(args, []any{"Heat", "7"}) {
+		t.Errorf("next page seeks past %v, want the last row", args)
+	}
+
+	metadata = next.keysetMetaData(first, last, false)
+	if metadata.NextCursor != "" || metadata.PrevCursor == "" {
+		t.Errorf("last page: got %+v", metadata)
+	}
+
+	c, err := decodeCursor(metadata.PrevCursor)
+	if err != nil || !c.Prev || !reflect.DeepEqual(c.Values, first.Values) {
+		t.Errorf("previous cursor: got %+v, %v", c, err)
+	}
+}
+
+func TestValidateFiltersRejectsMismatchedCursor(t *testing.T) {
+	f := Filters{
+		Sort:         "title",
+		SortSafeList: []string{"id", "title", "year"},
+		Keyset:       true,
+		PageSize:     10,
+		Cursor:       encodeCursor(cursor{Sort: "year", Values: []string{"1999", "7"}}),
+	}
+
+	v := validator.New()
+	if ValidateFilters(v, f); v.Valid() {
+		t.Error("expected the cursor of another sort to be rejected")
+	}
+}
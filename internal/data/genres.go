@@ -0,0 +1,471 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+var (
+	ErrDuplicateGenre = errors.New("duplicate genre")
+	ErrDuplicateAlias = errors.New("duplicate alias")
+
+	slugRX = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+const (
+	duplicateGenreConstraint = "genres_slug_key"
+	duplicateAliasConstraint = "genre_aliases_pkey"
+)
+
+type Genre struct {
+	ID int64 `json:"id"`
+
+	Slug    string   `json:"slug"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+
+	Version   int32     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Slugify turns a genre name into its slug, "Science Fiction" becomes
+// "science-fiction"
+func Slugify(name string) string {
+	return strings.Trim(slugRX.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// Vocabulary maps every known spelling of a genre, its slug, name and
+// aliases in lower case, to the genre's slug
+type Vocabulary map[string]string
+
+// Normalize returns the slug of the genre the name refers to
+func (v Vocabulary) Normalize(name string) (string, bool) {
+	slug, ok := v[strings.ToLower(strings.TrimSpace(name))]
+	return slug, ok
+}
+
+// NormalizeAll maps the names to their slugs, unknown names are kept as
+// they are
+func (v Vocabulary) NormalizeAll(names []string) []string {
+	normalized := make([]string, len(names))
+	for i, name := range names {
+		if slug, ok := v.Normalize(name); ok {
+			normalized[i] = slug
+		} else {
+			normalized[i] = name
+		}
+	}
+
+	return normalized
+}
+
+// GenreNames maps the slug of every genre to its name
+type GenreNames map[string]string
+
+// Display replaces the genre slugs of the movies by the genres' names, the
+// slugs are what is stored while responses carry the names. Unknown slugs
+// are kept as they are.
+func (n GenreNames) Display(movies ...*Movie) {
+	for _, movie := range movies {
+		for i, slug := range movie.Genres {
+			if name, ok := n[slug]; ok {
+				movie.Genres[i] = name
+			}
+		}
+	}
+}
+
+type GenreModel struct {
+	DB *sql.DB
+}
+
+func (m GenreModel) Insert(genre *Genre) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+					INSERT INTO genres
+					(slug, name)
+					VALUES
+					($1, $2)
+					RETURNING id, version, created_at
+	`
+
+	err = tx.QueryRowContext(ctx, query, genre.Slug, genre.Name).Scan(&genre.ID, &genre.Version, &genre.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err, duplicateGenreConstraint) {
+			return ErrDuplicateGenre
+		}
+
+		return err
+	}
+
+	for _, alias := range genre.Aliases {
+		if err := insertAlias(ctx, tx, genre.ID, alias); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m GenreModel) Select(id int64) (*Genre, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	var genre Genre
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					SELECT
+					genres.id, genres.slug, genres.name, genres.version, genres.created_at,
+					ARRAY(SELECT alias FROM genre_aliases WHERE genre_id = genres.id ORDER BY alias)
+					FROM genres
+					WHERE
+					genres.id = $1
+	`
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&genre.ID,
+		&genre.Slug,
+		&genre.Name,
+		&genre.Version,
+		&genre.CreatedAt,
+		pq.Array(&genre.Aliases),
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return &genre, nil
+}
+
+func (m GenreModel) SelectAll() ([]*Genre, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					SELECT
+					genres.id, genres.slug, genres.name, genres.version, genres.created_at,
+					ARRAY(SELECT alias FROM genre_aliases WHERE genre_id = genres.id ORDER BY alias)
+					FROM genres
+					ORDER BY genres.name, genres.id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+	for rows.Next() {
+		var genre Genre
+		err := rows.Scan(
+			&genre.ID,
+			&genre.Slug,
+			&genre.Name,
+			&genre.Version,
+			&genre.CreatedAt,
+			pq.Array(&genre.Aliases),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		genres = append(genres, &genre)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+// Vocabulary loads every known spelling of every genre
+func (m GenreModel) Vocabulary() (Vocabulary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					SELECT slug, slug FROM genres
+					UNION ALL
+					SELECT lower(name), slug FROM genres
+					UNION ALL
+					SELECT genre_aliases.alias, genres.slug FROM genre_aliases
+					INNER JOIN genres ON genres.id = genre_aliases.genre_id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vocabulary := make(Vocabulary)
+	for rows.Next() {
+		var spelling, slug string
+		if err := rows.Scan(&spelling, &slug); err != nil {
+			return nil, err
+		}
+
+		// slugs take precedence over names and aliases
+		if _, ok := vocabulary[spelling]; !ok {
+			vocabulary[spelling] = slug
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return vocabulary, nil
+}
+
+// Names loads the name of every genre
+func (m GenreModel) Names() (GenreNames, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT slug, name FROM genres`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(GenreNames)
+	for rows.Next() {
+		var slug, name string
+		if err := rows.Scan(&slug, &name); err != nil {
+			return nil, err
+		}
+
+		names[slug] = name
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// AddAlias registers another spelling for the genre
+func (m GenreModel) AddAlias(genreID int64, alias string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertAlias(ctx, tx, genreID, alias); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Rename changes the name and slug of the genre. When the slug changes
+// every movie using the old slug is rewritten, as the editing user, and
+// the old slug is kept as an alias.
+func (m GenreModel) Rename(genre *Genre, oldSlug string, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the new slug may already be an alias, of this genre it's dropped
+	// below, of another one the rename is refused
+	if genre.Slug != oldSlug {
+		var taken bool
+
+		query := `SELECT EXISTS (SELECT 1 FROM genre_aliases WHERE alias = $1 AND genre_id <> $2)`
+		if err := tx.QueryRowContext(ctx, query, genre.Slug, genre.ID).Scan(&taken); err != nil {
+			return err
+		}
+
+		if taken {
+			return ErrDuplicateAlias
+		}
+	}
+
+	query := `
+					UPDATE genres
+					SET
+					slug = $1, name = $2, version = version + 1
+					WHERE
+					id = $3 AND version = $4
+					RETURNING version
+	`
+	args := []any{genre.Slug, genre.Name, genre.ID, genre.Version}
+
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&genre.Version); err != nil {
+		switch {
+		case isUniqueViolation(err, duplicateGenreConstraint):
+			return ErrDuplicateGenre
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if genre.Slug != oldSlug {
+		if err := rewriteMovieGenres(ctx, tx, "array_replace(genres, $1, $2)", oldSlug, genre.Slug, userID); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM genre_aliases WHERE alias = $1 AND genre_id = $2`, genre.Slug, genre.ID); err != nil {
+			return err
+		}
+
+		if err := upsertAlias(ctx, tx, genre.ID, oldSlug); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Merge folds source into target, movies tagged with source are tagged
+// with target instead and every spelling of source becomes an alias of
+// target. The source genre is deleted.
+func (m GenreModel) Merge(source, target *Genre, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	set := `
+					CASE WHEN $2 = ANY(genres)
+					THEN array_remove(genres, $1)
+					ELSE array_replace(genres, $1, $2)
+					END
+	`
+	if err := rewriteMovieGenres(ctx, tx, set, source.Slug, target.Slug, userID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE genre_aliases SET genre_id = $1 WHERE genre_id = $2`, target.ID, source.ID); err != nil {
+		return err
+	}
+
+	for _, alias := range []string{source.Slug, strings.ToLower(source.Name)} {
+		if alias == target.Slug {
+			continue
+		}
+
+		if err := upsertAlias(ctx, tx, target.ID, alias); err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM genres WHERE id = $1 AND version = $2`, source.ID, source.Version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return tx.Commit()
+}
+
+// rewriteMovieGenres replaces the genres of every movie tagged with from
+// using the set expression, which receives from as $1 and to as $2. Each
+// rewritten movie gets a new version and a revision.
+func rewriteMovieGenres(ctx context.Context, tx *sql.Tx, set, from, to string, userID int64) error {
+	query := `
+					WITH updated AS (
+						UPDATE movies
+						SET
+						genres = ` + set + `, version = version + 1
+						WHERE
+						$1 = ANY(genres)
+						RETURNING id, version, title, year, runtime, genres
+					)
+					INSERT INTO movie_revisions
+					(movie_id, version, title, year, runtime, genres, user_id)
+					SELECT id, version, title, year, runtime, genres, $3 FROM updated
+	`
+
+	_, err := tx.ExecContext(ctx, query, from, to, nullableID(userID))
+	return err
+}
+
+func insertAlias(ctx context.Context, tx *sql.Tx, genreID int64, alias string) error {
+	query := `INSERT INTO genre_aliases (alias, genre_id) VALUES ($1, $2)`
+
+	if _, err := tx.ExecContext(ctx, query, strings.ToLower(alias), genreID); err != nil {
+		if isUniqueViolation(err, duplicateAliasConstraint) {
+			return ErrDuplicateAlias
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func upsertAlias(ctx context.Context, tx *sql.Tx, genreID int64, alias string) error {
+	query := `
+					INSERT INTO genre_aliases (alias, genre_id) VALUES ($1, $2)
+					ON CONFLICT (alias) DO UPDATE SET genre_id = EXCLUDED.genre_id
+	`
+
+	_, err := tx.ExecContext(ctx, query, strings.ToLower(alias), genreID)
+	return err
+}
+
+func ValidateGenre(v *validator.Validator, genre *Genre) {
+	v.Check(genre.Name != "", "name", "must be provided")
+	v.Check(len(genre.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(genre.Slug != "", "slug", "must be provided")
+	v.Check(genre.Slug == Slugify(genre.Slug), "slug", "must only contain lower case letters, digits and dashes")
+
+	for _, alias := range genre.Aliases {
+		v.Check(strings.TrimSpace(alias) != "", "aliases", "must not contain empty values")
+		v.Check(len(alias) <= 100, "aliases", "must not contain values more than 100 bytes long")
+	}
+
+	v.Check(validator.Unique(genre.Aliases), "aliases", "must not contain duplicate values")
+}
@@ -0,0 +1,57 @@
+package data
+
+import (
+	"database/sql/driver"
+	"slices"
+	"testing"
+)
+
+func TestGenreNamesDisplay(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := GenreModel{DB: db}
+
+	f.expect("SELECT slug, name FROM genres").returns([]string{"slug", "name"},
+		[]driver.Value{"science-fiction", "Science Fiction"},
+		[]driver.Value{"drama", "Drama"},
+	)
+
+	names, err := m.Names()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	movies := []*Movie{
+		{Genres: []string{"science-fiction", "drama"}},
+		{Genres: []string{"removed"}},
+		{},
+	}
+	names.Display(movies...)
+
+	if want := []string{"Science Fiction", "Drama"}; !slices.Equal(movies[0].Genres, want) {
+		t.Errorf("got %v, want %v", movies[0].Genres, want)
+	}
+
+	// a slug without a genre is kept as it is
+	if want := []string{"removed"}; !slices.Equal(movies[1].Genres, want) {
+		t.Errorf("got %v, want %v", movies[1].Genres, want)
+	}
+
+	if movies[2].Genres != nil {
+		t.Errorf("got %v for a movie loaded without its genres", movies[2].Genres)
+	}
+}
+
+func TestVocabularyNormalize(t *testing.T) {
+	genres := Vocabulary{"science-fiction": "science-fiction", "science fiction": "science-fiction", "sci-fi": "science-fiction"}
+
+	// the names served in responses are turned back into slugs on writes
+	for _, name := range []string{"Science Fiction", " sci-fi ", "science-fiction"} {
+		if slug, ok := genres.Normalize(name); !ok || slug != "science-fiction" {
+			t.Errorf("%q: got %q, %v", name, slug, ok)
+		}
+	}
+
+	if _, ok := genres.Normalize("western"); ok {
+		t.Error("unknown genres must not be normalized")
+	}
+}
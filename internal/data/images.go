@@ -0,0 +1,179 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+const (
+	ImagePoster   = "poster"
+	ImageBackdrop = "backdrop"
+)
+
+var ImageKinds = []string{ImagePoster, ImageBackdrop}
+
+type Image struct {
+	ID      int64 `json:"id"`
+	MovieID int64 `json:"-"`
+
+	Kind   string `json:"kind"`
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+
+	// URLs maps each variant of the image to where it can be downloaded,
+	// it's filled in by the API from the storage the files live in
+	URLs map[string]string `json:"urls"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Key returns the storage key of one of the image's variants
+func (i *Image) Key(variant string) string {
+	return fmt.Sprintf("movies/%d/images/%d/%s.%s", i.MovieID, i.ID, variant, i.Format)
+}
+
+type ImageModel struct {
+	DB *sql.DB
+}
+
+func (m ImageModel) Insert(image *Image) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					INSERT INTO movie_images
+					(movie_id, kind, format, width, height)
+					VALUES
+					($1, $2, $3, $4, $5)
+					RETURNING id, created_at
+	`
+	args := []any{image.MovieID, image.Kind, image.Format, image.Width, image.Height}
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&image.ID, &image.CreatedAt)
+}
+
+func (m ImageModel) Select(movieID, id int64) (*Image, error) {
+	if movieID < 1 || id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	var image Image
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					SELECT id, movie_id, kind, format, width, height, created_at
+					FROM movie_images
+					WHERE
+					movie_id = $1 AND id = $2
+	`
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, id).Scan(
+		&image.ID,
+		&image.MovieID,
+		&image.Kind,
+		&image.Format,
+		&image.Width,
+		&image.Height,
+		&image.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return &image, nil
+}
+
+// SelectForMovies returns the images of each of the movies, keyed by
+// movie id, newest first
+func (m ImageModel) SelectForMovies(movieIDs []int64) (map[int64][]*Image, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					SELECT id, movie_id, kind, format, width, height, created_at
+					FROM movie_images
+					WHERE
+					movie_id = ANY($1)
+					ORDER BY movie_id, created_at DESC, id DESC
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := make(map[int64][]*Image, len(movieIDs))
+	for rows.Next() {
+		var image Image
+		err := rows.Scan(
+			&image.ID,
+			&image.MovieID,
+			&image.Kind,
+			&image.Format,
+			&image.Width,
+			&image.Height,
+			&image.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		images[image.MovieID] = append(images[image.MovieID], &image)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+func (m ImageModel) Delete(movieID, id int64) error {
+	if movieID < 1 || id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					DELETE FROM movie_images
+					WHERE
+					movie_id = $1 AND id = $2
+	`
+
+	result, err := m.DB.ExecContext(ctx, query, movieID, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func ValidateImage(v *validator.Validator, image *Image) {
+	v.Check(image.Kind != "", "kind", "must be provided")
+	v.Check(validator.In(image.Kind, ImageKinds...), "kind", "must be one of poster or backdrop")
+}
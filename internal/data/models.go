@@ -1,8 +1,11 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+
+	"github.com/lib/pq"
 )
 
 var (
@@ -10,18 +13,62 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
+const (
+	uniqueViolationCode = "23505"
+)
+
 type Model struct {
-	Movie      MovieModel
-	User       UserModel
-	Token      TokenModel
-	Permission PermissionModel
+	Movie       MovieModel
+	User        UserModel
+	Token       TokenModel
+	Permission  PermissionModel
+	Person      PersonModel
+	Review      ReviewModel
+	Watchlist   WatchlistModel
+	History     HistoryModel
+	Revision    RevisionModel
+	Genre       GenreModel
+	Image       ImageModel
+	Comment     CommentModel
+	Session     SessionModel
+	APIKey      APIKeyModel
+	OAuthClient OAuthClientModel
+	OAuthCode   OAuthCodeModel
 }
 
 func NewModel(db *sql.DB) Model {
 	return Model{
-		Movie:      MovieModel{DB: db},
-		User:       UserModel{DB: db},
-		Token:      TokenModel{DB: db},
-		Permission: PermissionModel{DB: db},
+		Movie:       MovieModel{DB: db},
+		User:        UserModel{DB: db},
+		Token:       TokenModel{DB: db},
+		Permission:  PermissionModel{DB: db},
+		Person:      PersonModel{DB: db},
+		Review:      ReviewModel{DB: db},
+		Watchlist:   WatchlistModel{DB: db},
+		History:     HistoryModel{DB: db},
+		Revision:    RevisionModel{DB: db},
+		Genre:       GenreModel{DB: db},
+		Image:       ImageModel{DB: db},
+		Comment:     CommentModel{DB: db},
+		Session:     SessionModel{DB: db},
+		APIKey:      APIKeyModel{DB: db},
+		OAuthClient: OAuthClientModel{DB: db},
+		OAuthCode:   OAuthCodeModel{DB: db},
 	}
 }
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// isUniqueViolation reports whether err was raised by the given unique
+// constraint
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	return pqErr.Code == uniqueViolationCode && pqErr.Constraint == constraint
+}
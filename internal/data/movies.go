@@ -5,6 +5,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -20,8 +23,19 @@ type Movie struct {
 	Runtime Runtime  `json:"runtime"`
 	Genres  []string `json:"genres"`
 
-	Version   int32     `json:"version"`
-	CreatedAt time.Time `json:"created_at"`
+	AverageScore float64 `json:"average_score"`
+	ReviewCount  int64   `json:"review_count"`
+
+	Images  []*Image      `json:"images,omitempty"`
+	Credits []*CastMember `json:"credits,omitempty"`
+
+	Version   int32      `json:"version"`
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	// keys are the JSON keys written for the movie, set when it is loaded
+	// through a projection
+	keys []string
 }
 
 type MovieModel struct {
@@ -30,12 +44,38 @@ type MovieModel struct {
 
 const (
 	timeout = 10 * time.Second
+
+	// ratingsQuery aggregates the review scores of the movie in the
+	// enclosing query, meant to be joined laterally
+	ratingsQuery = `
+						SELECT round(avg(reviews.score), 2)::float8 AS average, count(*) AS count
+						FROM reviews
+						WHERE reviews.movie_id = movies.id
+	`
+
+	exportFetchSize = 500
 )
 
-func (m MovieModel) Insert(movie *Movie) error {
+// Insert creates the movie and records its first revision on behalf
+// of the given user
+func (m MovieModel) Insert(movie *Movie, userID int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertMovie(ctx, tx, movie, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertMovie(ctx context.Context, tx *sql.Tx, movie *Movie, userID int64) error {
 	query := `
 						INSERT INTO movies
 						(title, year, runtime, genres)
@@ -45,7 +85,7 @@ func (m MovieModel) Insert(movie *Movie) error {
 	`
 	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
 
-	row := m.DB.QueryRowContext(ctx, query, args...)
+	row := tx.QueryRowContext(ctx, query, args...)
 	if err := row.Scan(&movie.ID, &movie.CreatedAt, &movie.Version); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return ErrRecordNotFound
@@ -54,58 +94,191 @@ func (m MovieModel) Insert(movie *Movie) error {
 		return err
 	}
 
-	return nil
+	return insertRevision(ctx, tx, movie, userID)
 }
 
-func (m MovieModel) Select(id int64) (*Movie, error) {
-	var movie Movie
+// BatchRowError is returned by InsertBatch when one of the movies couldn't
+// be inserted, Index is its position in the batch. Nothing of the batch
+// is written then.
+type BatchRowError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchRowError) Error() string {
+	return fmt.Sprintf("movie %d of the batch: %v", e.Index, e.Err)
+}
+
+func (e *BatchRowError) Unwrap() error {
+	return e.Err
+}
+
+// InsertBatch creates all the movies in a single transaction, either
+// every movie is inserted or none is
+func (m MovieModel) InsertBatch(movies []*Movie, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+						INSERT INTO movies
+						(title, year, runtime, genres)
+						VALUES 
+						($1, $2, $3, $4)
+						RETURNING id, created_at, version
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, movie := range movies {
+		args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+
+		if err := stmt.QueryRowContext(ctx, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version); err != nil {
+			return &BatchRowError{Index: i, Err: err}
+		}
+
+		if err := insertRevision(ctx, tx, movie, userID); err != nil {
+			return &BatchRowError{Index: i, Err: err}
+		}
+	}
 
+	return tx.Commit()
+}
+
+// FindExisting reports for each movie whether a movie with the same
+// title, ignoring case, and year is already in the catalog
+func (m MovieModel) FindExisting(movies []*Movie) ([]bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
+	titles := make([]string, len(movies))
+	years := make([]int64, len(movies))
+	for i, movie := range movies {
+		titles[i] = strings.ToLower(movie.Title)
+		years[i] = int64(movie.Year)
+	}
+
 	query := `
+					SELECT
+					lower(title), year
+					FROM movies
+					WHERE
+					deleted_at IS NULL
+					AND
+					(lower(title), year) IN (SELECT * FROM unnest($1::text[], $2::integer[]))
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(titles), pq.Array(years))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[string]bool)
+	for rows.Next() {
+		var title string
+		var year int32
+
+		if err := rows.Scan(&title, &year); err != nil {
+			return nil, err
+		}
+
+		found[movieKey(title, year)] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	existing := make([]bool, len(movies))
+	for i := range movies {
+		existing[i] = found[movieKey(titles[i], movies[i].Year)]
+	}
+
+	return existing, nil
+}
+
+// movieKey identifies a movie by its lower cased title and year
+func movieKey(title string, year int32) string {
+	return fmt.Sprintf("%s|%d", strings.ToLower(title), year)
+}
+
+func (m MovieModel) Select(id int64) (*Movie, error) {
+	movie, err := m.SelectProjected(id, DefaultProjection())
+	if err != nil {
+		return nil, err
+	}
+
+	// the movie is written whole, whatever relations get attached to it
+	movie.keys = nil
+
+	return movie, nil
+}
+
+// SelectProjected is like Select but only loads the fields and related
+// data of the projection
+func (m MovieModel) SelectProjected(id int64, projection Projection) (*Movie, error) {
+	movie := Movie{keys: projection.keys()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// the version is always loaded as it makes the movie's ETag
+	columns := projection.columns("id", "version")
+
+	query := fmt.Sprintf(`
 						SELECT 
-						id, title, year, runtime, genres, version, created_at 
+						%s
 						FROM movies 
+						%s
 						WHERE 
-						id = $1
-	`
+						id = $1 AND deleted_at IS NULL
+	`, projection.selectList(columns), projection.ratingsJoin())
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&movie.ID,
-		&movie.Title,
-		&movie.Year,
-		&movie.Runtime,
-		pq.Array(&movie.Genres),
-		&movie.Version,
-		&movie.CreatedAt,
-	)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(projection.targets(&movie, columns)...)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
 		return nil, err
 	}
 
 	return &movie, nil
 }
 
-func (m MovieModel) SelectMany(title string, genres []string, filters Filters) ([]*Movie, MetaData, error) {
+func (m MovieModel) SelectMany(search MovieSearch, filters Filters, projection Projection) ([]*Movie, MetaData, error) {
+	if filters.Keyset {
+		return m.selectManyByCursor(search, filters, projection)
+	}
+
 	total := 0
 	var movies []*Movie
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
+	columns := projection.columns("id")
+	keys := projection.keys()
+
 	query := fmt.Sprintf(`
 				SELECT
-				count(*) OVER(), id, title, year, runtime, genres, version, created_at
+				count(*) OVER(), %s
 				FROM movies
+				%s
 				WHERE
-				(to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-				AND
-				(genres @> $2 OR $2 = '{}')
-				ORDER BY %s %s, id ASC
-				LIMIT $3
-				OFFSET $4
-	`, filters.sortColumn(), filters.sortDirection())
-	args := []any{title, pq.Array(genres), filters.limit(), filters.offset()}
+				%s
+				ORDER BY %s
+				LIMIT $%d
+				OFFSET $%d
+	`, projection.selectList(columns), projection.ratingsJoin(), search.clause(), search.orderBy(filters), len(search.args())+1, len(search.args())+2)
+	args := append(search.args(), filters.limit(), filters.offset())
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, MetaData{}, err
@@ -114,17 +287,8 @@ func (m MovieModel) SelectMany(title string, genres []string, filters Filters) (
 	defer rows.Close()
 
 	for rows.Next() {
-		var movie Movie
-		err := rows.Scan(
-			&total,
-			&movie.ID,
-			&movie.Title,
-			&movie.Year,
-			&movie.Runtime,
-			pq.Array(&movie.Genres),
-			&movie.Version,
-			&movie.CreatedAt,
-		)
+		movie := Movie{keys: keys}
+		err := rows.Scan(append([]any{&total}, projection.targets(&movie, columns)...)...)
 		if err != nil {
 			return nil, MetaData{}, err
 		}
@@ -141,10 +305,197 @@ func (m MovieModel) SelectMany(title string, genres []string, filters Filters) (
 	return movies, metadata, nil
 }
 
-func (m MovieModel) Update(movie *Movie) error {
+// selectManyByCursor is the keyset variant of SelectMany, it seeks past
+// the cursor instead of counting and skipping rows
+func (m MovieModel) selectManyByCursor(search MovieSearch, filters Filters, projection Projection) ([]*Movie, MetaData, error) {
+	movies := []*Movie{}
+
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
+	// the limit follows the search parameters, then come the cursor's
+	limit := len(search.args()) + 1
+	condition, order, keysetArgs := filters.keyset(limit + 1)
+
+	// the sort column is always loaded as the cursors are built from it
+	columns := projection.columns(filters.sortColumns()...)
+	keys := projection.keys()
+
+	query := fmt.Sprintf(`
+				SELECT
+				%s
+				FROM movies
+				%s
+				WHERE
+				%s
+				AND
+				%s
+				ORDER BY %s
+				LIMIT $%d
+	`, projection.selectList(columns), projection.ratingsJoin(), search.clause(), condition, order, limit)
+	args := append(append(search.args(), filters.limit()+1), keysetArgs...)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		movie := Movie{keys: keys}
+		if err := rows.Scan(projection.targets(&movie, columns)...); err != nil {
+			return nil, MetaData{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, MetaData{}, err
+	}
+
+	more := len(movies) > filters.limit()
+	if more {
+		movies = movies[:filters.limit()]
+	}
+
+	if c, _ := decodeCursor(filters.Cursor); filters.Cursor != "" && c.Prev {
+		slices.Reverse(movies)
+	}
+
+	if len(movies) == 0 {
+		return movies, MetaData{PageSize: filters.PageSize}, nil
+	}
+
+	columns = filters.sortColumns()
+	first, last := movies[0], movies[len(movies)-1]
+
+	metadata := filters.keysetMetaData(
+		cursor{Values: first.sortValues(columns)},
+		cursor{Values: last.sortValues(columns)},
+		more,
+	)
+
+	return movies, metadata, nil
+}
+
+// Export walks every movie matching the filters through a server-side
+// cursor, fetching them in chunks so the whole result is never held in
+// memory. fn is called for each movie in id order.
+func (m MovieModel) Export(ctx context.Context, search MovieSearch, fn func(*Movie) error) error {
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`
+				DECLARE movies_export NO SCROLL CURSOR FOR
+				SELECT
+				id, title, year, runtime, genres, version, created_at,
+				COALESCE(ratings.average, 0), ratings.count
+				FROM movies
+				LEFT JOIN LATERAL (%s) ratings ON true
+				WHERE
+				%s
+				ORDER BY id ASC
+	`, ratingsQuery, search.clause())
+
+	if _, err := tx.ExecContext(ctx, query, search.args()...); err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM movies_export", exportFetchSize)
+
+	for {
+		rows, err := tx.QueryContext(ctx, fetch)
+		if err != nil {
+			return err
+		}
+
+		fetched := 0
+		for rows.Next() {
+			var movie Movie
+			err := rows.Scan(
+				&movie.ID,
+				&movie.Title,
+				&movie.Year,
+				&movie.Runtime,
+				pq.Array(&movie.Genres),
+				&movie.Version,
+				&movie.CreatedAt,
+				&movie.AverageScore,
+				&movie.ReviewCount,
+			)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			if err := fn(&movie); err != nil {
+				rows.Close()
+				return err
+			}
+
+			fetched++
+		}
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		rows.Close()
+
+		if fetched < exportFetchSize {
+			break
+		}
+	}
+
+	return tx.Commit()
+}
+
+// sortValues returns the values of the given sort columns as text, used
+// to build pagination cursors
+func (movie *Movie) sortValues(columns []string) []string {
+	values := make([]string, len(columns))
+
+	for i, column := range columns {
+		switch column {
+		case "title":
+			values[i] = movie.Title
+		case "year":
+			values[i] = strconv.Itoa(int(movie.Year))
+		case "runtime":
+			values[i] = strconv.Itoa(int(movie.Runtime))
+		default:
+			values[i] = strconv.FormatInt(movie.ID, 10)
+		}
+	}
+
+	return values
+}
+
+// Update saves the movie if it is still at the version it was read at
+// and records the new version as a revision made by the given user
+func (m MovieModel) Update(movie *Movie, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updateMovie(ctx, tx, movie, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func updateMovie(ctx context.Context, tx *sql.Tx, movie *Movie, userID int64) error {
 	query := `
 					UPDATE movies
 					SET
@@ -153,11 +504,13 @@ func (m MovieModel) Update(movie *Movie) error {
 					version = $5 
 					AND
 					id = $6
+					AND
+					deleted_at IS NULL
 					RETURNING version
 	`
 	args := []any{&movie.Title, &movie.Year, &movie.Runtime, pq.Array(&movie.Genres), &movie.Version, &movie.ID}
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return ErrEditConflict
@@ -165,9 +518,11 @@ func (m MovieModel) Update(movie *Movie) error {
 		return err
 	}
 
-	return nil
+	return insertRevision(ctx, tx, movie, userID)
 }
 
+// Delete moves the movie to the trash, it can be brought back with
+// Restore until it is purged
 func (m MovieModel) Delete(id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
@@ -177,10 +532,11 @@ func (m MovieModel) Delete(id int64) error {
 	defer cancel()
 
 	query := `
-					DELETE 
-					FROM movies
+					UPDATE movies
+					SET
+					deleted_at = NOW()
 					WHERE
-					id = $1
+					id = $1 AND deleted_at IS NULL
 	`
 
 	result, err := m.DB.ExecContext(ctx, query, id)
@@ -200,7 +556,224 @@ func (m MovieModel) Delete(id int64) error {
 	return nil
 }
 
-func ValidateMovie(v *validator.Validator, movie *Movie) {
+// DeleteVersion moves the movie to the trash only if it is still at the
+// given version
+func (m MovieModel) DeleteVersion(id int64, version int32) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return deleteMovieVersion(ctx, m.DB, id, version)
+}
+
+func deleteMovieVersion(ctx context.Context, db execer, id int64, version int32) error {
+	query := `
+					UPDATE movies
+					SET
+					deleted_at = NOW()
+					WHERE
+					id = $1 AND version = $2 AND deleted_at IS NULL
+	`
+
+	result, err := db.ExecContext(ctx, query, id, version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// SelectTrashed lists the movies that are in the trash
+func (m MovieModel) SelectTrashed(filters Filters) ([]*Movie, MetaData, error) {
+	total := 0
+	movies := []*Movie{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := fmt.Sprintf(`
+				SELECT
+				count(*) OVER(), id, title, year, runtime, genres, version, created_at, deleted_at
+				FROM movies
+				WHERE
+				deleted_at IS NOT NULL
+				ORDER BY %s
+				LIMIT $1
+				OFFSET $2
+	`, filters.orderBy("id"))
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(
+			&total,
+			&movie.ID,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.CreatedAt,
+			&movie.DeletedAt,
+		)
+		if err != nil {
+			return nil, MetaData{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, MetaData{}, err
+	}
+
+	metadata := calculateMetaData(total, filters.Page, filters.PageSize)
+
+	return movies, metadata, nil
+}
+
+// Restore takes a movie out of the trash
+func (m MovieModel) Restore(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					UPDATE movies
+					SET
+					deleted_at = NULL
+					WHERE
+					id = $1 AND deleted_at IS NOT NULL
+	`
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Purge permanently deletes a movie, only movies in the trash can be
+// purged. The images of the movie are returned so their files can be
+// removed from storage.
+func (m MovieModel) Purge(id int64) ([]*Image, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					WITH purged AS (
+						DELETE
+						FROM movies
+						WHERE
+						id = $1 AND deleted_at IS NOT NULL
+						RETURNING id
+					)
+					SELECT purged.id, movie_images.id, movie_images.format
+					FROM purged
+					LEFT JOIN movie_images
+					ON movie_images.movie_id = purged.id
+	`
+
+	purged, images, err := scanPurged(m.DB.QueryContext(ctx, query, id))
+	if err != nil {
+		return nil, err
+	}
+
+	if purged == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return images, nil
+}
+
+// PurgeTrashedBefore permanently deletes the movies trashed before the
+// cutoff and returns how many were removed, along with their images
+func (m MovieModel) PurgeTrashedBefore(cutoff time.Time) (int64, []*Image, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					WITH purged AS (
+						DELETE FROM movies WHERE deleted_at < $1 RETURNING id
+					)
+					SELECT purged.id, movie_images.id, movie_images.format
+					FROM purged
+					LEFT JOIN movie_images
+					ON movie_images.movie_id = purged.id
+	`
+
+	return scanPurged(m.DB.QueryContext(ctx, query, cutoff))
+}
+
+// scanPurged reads the rows of a purge, one per image of every purged
+// movie or a single one without an image. The images are read in the same
+// statement as the delete, before it cascades to them.
+func scanPurged(rows *sql.Rows, err error) (int64, []*Image, error) {
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	movies := make(map[int64]bool)
+	images := []*Image{}
+
+	for rows.Next() {
+		var movieID int64
+		var imageID sql.NullInt64
+		var format sql.NullString
+
+		if err := rows.Scan(&movieID, &imageID, &format); err != nil {
+			return 0, nil, err
+		}
+
+		movies[movieID] = true
+
+		if imageID.Valid {
+			images = append(images, &Image{ID: imageID.Int64, MovieID: movieID, Format: format.String})
+		}
+	}
+
+	return int64(len(movies)), images, rows.Err()
+}
+
+// ValidateMovie checks the movie, its genres are looked up in the
+// vocabulary and replaced by their slugs
+func ValidateMovie(v *validator.Validator, movie *Movie, genres Vocabulary) {
 	v.Check(movie.Title != "", "title", "must be provided")
 	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
 
@@ -215,6 +788,15 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(len(movie.Genres) >= 1, "genres", "must contain at least 1 genre")
 	v.Check(len(movie.Genres) <= 5, "genres", "must not contain more than 5 genres")
 
-	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate values")
+	for i, genre := range movie.Genres {
+		slug, ok := genres.Normalize(genre)
+		if !ok {
+			v.AddErrors("genres", fmt.Sprintf("unknown genre %q", genre))
+			continue
+		}
 
+		movie.Genres[i] = slug
+	}
+
+	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate values")
 }
@@ -0,0 +1,104 @@
+package data
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+var purgeColumns = []string{"id", "id", "format"}
+
+func TestMovieDeleteAndRestore(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := MovieModel{DB: db}
+
+	f.expect("deleted_at = NOW()").affects(1)
+	f.expect("deleted_at = NOW()").affects(0)
+	f.expect("deleted_at = NULL").affects(1)
+	f.expect("deleted_at = NULL").affects(0)
+
+	if err := m.Delete(5); err != nil {
+		t.Fatal(err)
+	}
+
+	// a movie already in the trash can't be deleted again
+	if err := m.Delete(5); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("trashed movie: got %v, want ErrRecordNotFound", err)
+	}
+
+	if err := m.Restore(5); err != nil {
+		t.Fatal(err)
+	}
+
+	// only a movie in the trash can be restored
+	if err := m.Restore(5); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("movie out of the trash: got %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestMovieDeleteVersion(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := MovieModel{DB: db}
+
+	deleted := f.expect("id = $1 AND version = $2 AND deleted_at IS NULL").affects(0)
+
+	if err := m.DeleteVersion(5, 3); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("got %v, want ErrEditConflict", err)
+	}
+
+	if deleted.args[0] != int64(5) || deleted.args[1] != int64(3) {
+		t.Errorf("got args %v", deleted.args)
+	}
+}
+
+func TestMoviePurge(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := MovieModel{DB: db}
+
+	f.expect("WITH purged AS").returns(purgeColumns,
+		[]driver.Value{int64(5), int64(1), "jpeg"},
+		[]driver.Value{int64(5), int64(2), "png"},
+	)
+	// a movie that isn't in the trash isn't purged
+	f.expect("WITH purged AS").returns(purgeColumns)
+
+	images, err := m.Purge(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(images) != 2 || images[0].ID != 1 || images[0].MovieID != 5 || images[1].Format != "png" {
+		t.Errorf("got images %v", images)
+	}
+
+	if _, err := m.Purge(6); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestMoviePurgeTrashedBefore(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := MovieModel{DB: db}
+
+	cutoff := time.Now().Add(-30 * 24 * time.Hour)
+
+	purge := f.expect("deleted_at < $1").returns(purgeColumns,
+		[]driver.Value{int64(5), int64(1), "jpeg"},
+		[]driver.Value{int64(6), nil, nil},
+	)
+
+	purged, images, err := m.PurgeTrashedBefore(cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a movie without images still counts once
+	if purged != 2 || len(images) != 1 || images[0].MovieID != 5 {
+		t.Errorf("got %d purged, images %v", purged, images)
+	}
+
+	if !purge.args[0].(time.Time).Equal(cutoff) {
+		t.Errorf("got cutoff %v, want %v", purge.args[0], cutoff)
+	}
+}
@@ -0,0 +1,371 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+const (
+	// OAuthSecretPrefix starts every client secret, so leaked secrets are
+	// easy to spot
+	OAuthSecretPrefix = "bbs_"
+
+	// OAuthCodeTTL is how long an authorization code can be traded for
+	// tokens
+	OAuthCodeTTL = 10 * time.Minute
+)
+
+// OAuthClient is a third party application acting on behalf of users.
+// Confidential clients hold a secret, Secret is only set when the client
+// is registered, only its hash is stored.
+type OAuthClient struct {
+	ID       int64  `json:"id"`
+	ClientID string `json:"client_id"`
+	Secret   string `json:"client_secret,omitempty"`
+	UserID   int64  `json:"-"`
+
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	secretHash []byte
+}
+
+// MatchesSecret reports whether secret is the one of the client, public
+// clients have none to match
+func (c *OAuthClient) MatchesSecret(secret string) bool {
+	if !c.Confidential {
+		return false
+	}
+
+	hash := sha256.Sum256([]byte(secret))
+	return subtle.ConstantTimeCompare(hash[:], c.secretHash) == 1
+}
+
+// AllowsRedirectURI reports whether uri is one of the registered redirect
+// uris, they must match exactly
+func (c *OAuthClient) AllowsRedirectURI(uri string) bool {
+	for _, registered := range c.RedirectURIs {
+		if registered == uri {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsScopes reports whether every one of scopes was registered for the
+// client
+func (c *OAuthClient) AllowsScopes(scopes []string) bool {
+	for _, scope := range scopes {
+		if !Permissions(c.Scopes).Contains(scope) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type OAuthClientModel struct {
+	DB *sql.DB
+}
+
+// New generates the client id, and the secret of confidential clients,
+// and stores the client
+func (m OAuthClientModel) New(client *OAuthClient) error {
+	randomBytes := make([]byte, 16)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return err
+	}
+
+	client.ClientID = hex.EncodeToString(randomBytes)
+
+	if client.Confidential {
+		randomBytes := make([]byte, 20)
+		if _, err := rand.Read(randomBytes); err != nil {
+			return err
+		}
+
+		client.Secret = OAuthSecretPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+
+		hash := sha256.Sum256([]byte(client.Secret))
+		client.secretHash = hash[:]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					INSERT INTO oauth_clients
+					(client_id, secret_hash, user_id, name, redirect_uris, scopes)
+					VALUES
+					($1, $2, $3, $4, $5, $6)
+					RETURNING id, created_at
+	`
+	args := []any{client.ClientID, client.secretHash, client.UserID, client.Name, pq.Array(client.RedirectURIs), pq.Array(client.Scopes)}
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&client.ID, &client.CreatedAt)
+}
+
+// Get returns the client registered with the public client id
+func (m OAuthClientModel) Get(clientID string) (*OAuthClient, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					SELECT id, client_id, secret_hash, user_id, name, redirect_uris, scopes, created_at
+					FROM oauth_clients
+					WHERE
+					client_id = $1
+	`
+
+	var client OAuthClient
+
+	err := m.DB.QueryRowContext(ctx, query, clientID).Scan(
+		&client.ID,
+		&client.ClientID,
+		&client.secretHash,
+		&client.UserID,
+		&client.Name,
+		pq.Array(&client.RedirectURIs),
+		pq.Array(&client.Scopes),
+		&client.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	client.Confidential = client.secretHash != nil
+
+	return &client, nil
+}
+
+func (m OAuthClientModel) SelectAllForUser(userID int64) ([]*OAuthClient, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					SELECT id, client_id, secret_hash IS NOT NULL, user_id, name, redirect_uris, scopes, created_at
+					FROM oauth_clients
+					WHERE
+					user_id = $1
+					ORDER BY id ASC
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []*OAuthClient{}
+	for rows.Next() {
+		var client OAuthClient
+		err := rows.Scan(
+			&client.ID,
+			&client.ClientID,
+			&client.Confidential,
+			&client.UserID,
+			&client.Name,
+			pq.Array(&client.RedirectURIs),
+			pq.Array(&client.Scopes),
+			&client.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		clients = append(clients, &client)
+	}
+
+	return clients, rows.Err()
+}
+
+// Delete removes the client of the user, along with every session and
+// code it was granted
+func (m OAuthClientModel) Delete(userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM oauth_clients WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ValidateOAuthClient checks the client's scopes against the permissions
+// there are, a client can request any of them but users only grant the
+// ones they hold
+func ValidateOAuthClient(v *validator.Validator, client *OAuthClient, permissions Permissions) {
+	v.Check(client.Name != "", "name", "must be provided")
+	v.Check(len(client.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(client.RedirectURIs) > 0, "redirect_uris", "must contain at least 1 uri")
+	v.Check(len(client.RedirectURIs) <= 10, "redirect_uris", "must not contain more than 10 uris")
+	v.Check(validator.Unique(client.RedirectURIs), "redirect_uris", "must not contain duplicate values")
+
+	for _, uri := range client.RedirectURIs {
+		v.Check(validRedirectURI(uri), "redirect_uris", fmt.Sprintf("%q must be an absolute https uri without a fragment", uri))
+	}
+
+	v.Check(len(client.Scopes) > 0, "scopes", "must contain at least 1 scope")
+	v.Check(validator.Unique(client.Scopes), "scopes", "must not contain duplicate values")
+
+	for _, scope := range client.Scopes {
+		v.Check(permissions.Contains(scope), "scopes", fmt.Sprintf("%q is not a permission", scope))
+	}
+}
+
+// validRedirectURI only accepts https uris, plain http is allowed for
+// loopback addresses so native apps can receive the code
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.Fragment != "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		return validator.In(u.Hostname(), "localhost", "127.0.0.1", "::1")
+	default:
+		return false
+	}
+}
+
+// OAuthCode is an authorization code, it's traded once for the tokens of
+// a session with the scopes the user consented to. Only the hash of the
+// code is stored.
+type OAuthCode struct {
+	Text     string
+	Hash     []byte
+	ClientID int64
+	UserID   int64
+
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+
+	// RedirectURIExplicit is set when the authorization request named the
+	// redirect uri, the token request has to name it again
+	RedirectURIExplicit bool
+
+	Expiry time.Time
+}
+
+type OAuthCodeModel struct {
+	DB *sql.DB
+}
+
+// New generates the code and stores its hash
+func (m OAuthCodeModel) New(code *OAuthCode) error {
+	token, err := generateToken(code.UserID, OAuthCodeTTL, "")
+	if err != nil {
+		return err
+	}
+
+	code.Text, code.Hash, code.Expiry = token.Text, token.Hash, token.Expiry
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					INSERT INTO oauth_codes
+					(hash, client_id, user_id, redirect_uri, redirect_uri_explicit, scopes, code_challenge, expiry)
+					VALUES
+					($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	args := []any{code.Hash, code.ClientID, code.UserID, code.RedirectURI, code.RedirectURIExplicit, pq.Array(code.Scopes), code.CodeChallenge, code.Expiry}
+
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// Consume deletes the code and returns it, a code can only be used once
+// even when the exchange fails afterwards
+func (m OAuthCodeModel) Consume(text string) (*OAuthCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	hash := sha256.Sum256([]byte(text))
+	code := OAuthCode{Text: text, Hash: hash[:]}
+
+	query := `
+					DELETE FROM oauth_codes
+					WHERE
+					hash = $1
+					RETURNING client_id, user_id, redirect_uri, redirect_uri_explicit, scopes, code_challenge, expiry
+	`
+
+	err := m.DB.QueryRowContext(ctx, query, code.Hash).Scan(
+		&code.ClientID,
+		&code.UserID,
+		&code.RedirectURI,
+		&code.RedirectURIExplicit,
+		pq.Array(&code.Scopes),
+		&code.CodeChallenge,
+		&code.Expiry,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	if time.Now().After(code.Expiry) {
+		return nil, ErrRecordNotFound
+	}
+
+	return &code, nil
+}
+
+// DeleteExpired deletes the codes that were never traded, it returns how
+// many were deleted
+func (m OAuthCodeModel) DeleteExpired() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM oauth_codes WHERE expiry < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,355 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+var (
+	ErrDuplicateCredit = errors.New("duplicate credit")
+)
+
+const (
+	RoleDirector = "director"
+	RoleWriter   = "writer"
+	RoleActor    = "actor"
+
+	duplicateCreditConstraint = "movie_credits_unique_key"
+)
+
+var CreditRoles = []string{RoleDirector, RoleWriter, RoleActor}
+
+type Person struct {
+	ID int64 `json:"id"`
+
+	Name      string `json:"name"`
+	Biography string `json:"biography,omitempty"`
+
+	Version   int32     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Credit links a person to a movie with the role they had in it
+type Credit struct {
+	ID       int64 `json:"id"`
+	MovieID  int64 `json:"movie_id"`
+	PersonID int64 `json:"person_id"`
+
+	Role         string `json:"role"`
+	Character    string `json:"character,omitempty"`
+	BillingOrder int32  `json:"billing_order"`
+
+	CreatedAt time.Time `json:"-"`
+}
+
+// CastMember is a credit of a movie together with the credited person's name
+type CastMember struct {
+	Credit
+	Name string `json:"name"`
+}
+
+// FilmographyEntry is a credit of a person together with the movie details
+type FilmographyEntry struct {
+	Credit
+	Title string `json:"title"`
+	Year  int32  `json:"year"`
+}
+
+type PersonModel struct {
+	DB *sql.DB
+}
+
+func (p PersonModel) Insert(person *Person) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					INSERT INTO people
+					(name, biography)
+					VALUES
+					($1, $2)
+					RETURNING id, version, created_at
+	`
+
+	return p.DB.QueryRowContext(ctx, query, person.Name, person.Biography).Scan(&person.ID, &person.Version, &person.CreatedAt)
+}
+
+func (p PersonModel) Select(id int64) (*Person, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	var person Person
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					SELECT
+					id, name, biography, version, created_at
+					FROM people
+					WHERE
+					id = $1
+	`
+
+	err := p.DB.QueryRowContext(ctx, query, id).Scan(
+		&person.ID,
+		&person.Name,
+		&person.Biography,
+		&person.Version,
+		&person.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return &person, nil
+}
+
+func (p PersonModel) Update(person *Person) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					UPDATE people
+					SET
+					name = $1, biography = $2, version = version + 1
+					WHERE
+					id = $3 AND version = $4
+					RETURNING version
+	`
+	args := []any{person.Name, person.Biography, person.ID, person.Version}
+
+	if err := p.DB.QueryRowContext(ctx, query, args...).Scan(&person.Version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (p PersonModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := p.DB.ExecContext(ctx, `DELETE FROM people WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// AddCredit records a person's role on a movie
+func (p PersonModel) AddCredit(credit *Credit) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					INSERT INTO movie_credits
+					(movie_id, person_id, role, character, billing_order)
+					VALUES
+					($1, $2, $3, $4, $5)
+					RETURNING id, created_at
+	`
+	args := []any{credit.MovieID, credit.PersonID, credit.Role, credit.Character, credit.BillingOrder}
+
+	if err := p.DB.QueryRowContext(ctx, query, args...).Scan(&credit.ID, &credit.CreatedAt); err != nil {
+		if isUniqueViolation(err, duplicateCreditConstraint) {
+			return ErrDuplicateCredit
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// RemoveCredit deletes a single credit from a movie
+func (p PersonModel) RemoveCredit(movieID, creditID int64) error {
+	if creditID < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `DELETE FROM movie_credits WHERE id = $1 AND movie_id = $2`
+
+	result, err := p.DB.ExecContext(ctx, query, creditID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// CreditsForMovie returns the cast and crew of a movie ordered by role
+// and billing order
+func (p PersonModel) CreditsForMovie(movieID int64) ([]*CastMember, error) {
+	credits, err := p.CreditsForMovies([]int64{movieID})
+	if err != nil {
+		return nil, err
+	}
+
+	if credits[movieID] == nil {
+		return []*CastMember{}, nil
+	}
+
+	return credits[movieID], nil
+}
+
+// CreditsForMovies is like CreditsForMovie for several movies at once,
+// the credits are keyed by movie id
+func (p PersonModel) CreditsForMovies(movieIDs []int64) (map[int64][]*CastMember, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					SELECT
+					movie_credits.id, movie_credits.movie_id, movie_credits.person_id,
+					movie_credits.role, movie_credits.character, movie_credits.billing_order,
+					movie_credits.created_at, people.name
+					FROM movie_credits
+					INNER JOIN people ON people.id = movie_credits.person_id
+					WHERE
+					movie_credits.movie_id = ANY($1)
+					ORDER BY movie_credits.movie_id, movie_credits.role, movie_credits.billing_order, movie_credits.id
+	`
+
+	rows, err := p.DB.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := make(map[int64][]*CastMember, len(movieIDs))
+	for rows.Next() {
+		var member CastMember
+		err := rows.Scan(
+			&member.ID,
+			&member.MovieID,
+			&member.PersonID,
+			&member.Role,
+			&member.Character,
+			&member.BillingOrder,
+			&member.CreatedAt,
+			&member.Name,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		credits[member.MovieID] = append(credits[member.MovieID], &member)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+// Filmography returns every credit of a person, newest movies first
+func (p PersonModel) Filmography(personID int64) ([]*FilmographyEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					SELECT
+					movie_credits.id, movie_credits.movie_id, movie_credits.person_id,
+					movie_credits.role, movie_credits.character, movie_credits.billing_order,
+					movie_credits.created_at, movies.title, movies.year
+					FROM movie_credits
+					INNER JOIN movies ON movies.id = movie_credits.movie_id
+					WHERE
+					movie_credits.person_id = $1 AND movies.deleted_at IS NULL
+					ORDER BY movies.year DESC, movies.id, movie_credits.role
+	`
+
+	rows, err := p.DB.QueryContext(ctx, query, personID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*FilmographyEntry{}
+	for rows.Next() {
+		var entry FilmographyEntry
+		err := rows.Scan(
+			&entry.ID,
+			&entry.MovieID,
+			&entry.PersonID,
+			&entry.Role,
+			&entry.Character,
+			&entry.BillingOrder,
+			&entry.CreatedAt,
+			&entry.Title,
+			&entry.Year,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func ValidatePerson(v *validator.Validator, person *Person) {
+	v.Check(person.Name != "", "name", "must be provided")
+	v.Check(len(person.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	v.Check(len(person.Biography) <= 10_000, "biography", "must not be more than 10000 bytes long")
+}
+
+func ValidateCredit(v *validator.Validator, credit *Credit) {
+	v.Check(credit.PersonID > 0, "person_id", "must be provided")
+
+	v.Check(credit.Role != "", "role", "must be provided")
+	v.Check(validator.In(credit.Role, CreditRoles...), "role", "must be one of director, writer or actor")
+
+	v.Check(credit.Character == "" || credit.Role == RoleActor, "character", "must only be set for actors")
+	v.Check(len(credit.Character) <= 500, "character", "must not be more than 500 bytes long")
+
+	v.Check(credit.BillingOrder >= 0, "billing_order", "must not be negative")
+}
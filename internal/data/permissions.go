@@ -19,6 +19,18 @@ func (p Permissions) Contains(code string) bool {
 	return false
 }
 
+// Narrow returns the permissions that are also in codes
+func (p Permissions) Narrow(codes []string) Permissions {
+	narrowed := Permissions{}
+	for _, code := range codes {
+		if p.Contains(code) {
+			narrowed = append(narrowed, code)
+		}
+	}
+
+	return narrowed
+}
+
 type PermissionModel struct {
 	DB *sql.DB
 }
@@ -37,6 +49,30 @@ func (p PermissionModel) GrantUser(userID int64, codes ...string) error {
 	return err
 }
 
+// GetAll returns the code of every permission there is
+func (p PermissionModel) GetAll() (Permissions, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	rows, err := p.DB.QueryContext(ctx, `SELECT code FROM permissions ORDER BY id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := Permissions{}
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
+
 func (p PermissionModel) GetUserPermissions(userID int64) (Permissions, error) {
 	var permissions Permissions
 
@@ -0,0 +1,187 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+const (
+	IncludeCredits = "credits"
+	IncludeRatings = "ratings"
+	IncludeImages  = "images"
+)
+
+var (
+	// MovieFields are the movie columns a projection can pick
+	MovieFields = []string{"id", "title", "year", "runtime", "genres", "version", "created_at"}
+
+	// MovieIncludes are the related data a projection can embed
+	MovieIncludes = []string{IncludeCredits, IncludeRatings, IncludeImages}
+
+	// DefaultIncludes are embedded when the client doesn't ask for any
+	DefaultIncludes = []string{IncludeRatings, IncludeImages}
+)
+
+// Projection picks the fields and the related data of the movies to load,
+// no Fields means every field
+type Projection struct {
+	Fields   []string
+	Includes []string
+}
+
+// DefaultProjection loads every field with the default includes
+func DefaultProjection() Projection {
+	return Projection{Includes: DefaultIncludes}
+}
+
+func (p Projection) Has(include string) bool {
+	return slices.Contains(p.Includes, include)
+}
+
+// columns returns the requested fields together with the extra ones the
+// query needs, in the order of MovieFields
+func (p Projection) columns(extra ...string) []string {
+	columns := []string{}
+	for _, field := range MovieFields {
+		if len(p.Fields) == 0 || slices.Contains(p.Fields, field) || slices.Contains(extra, field) {
+			columns = append(columns, field)
+		}
+	}
+
+	return columns
+}
+
+// selectList returns the SELECT list of the columns, followed by the
+// ratings when they are included
+func (p Projection) selectList(columns []string) string {
+	list := strings.Join(columns, ", ")
+	if p.Has(IncludeRatings) {
+		list += ", COALESCE(ratings.average, 0), ratings.count"
+	}
+
+	return list
+}
+
+// ratingsJoin joins the ratings of each movie when they are included
+func (p Projection) ratingsJoin() string {
+	if !p.Has(IncludeRatings) {
+		return ""
+	}
+
+	return fmt.Sprintf("LEFT JOIN LATERAL (%s) ratings ON true", ratingsQuery)
+}
+
+// targets returns the scan destinations matching selectList
+func (p Projection) targets(movie *Movie, columns []string) []any {
+	targets := make([]any, 0, len(columns)+2)
+	for _, column := range columns {
+		targets = append(targets, movie.field(column))
+	}
+
+	if p.Has(IncludeRatings) {
+		targets = append(targets, &movie.AverageScore, &movie.ReviewCount)
+	}
+
+	return targets
+}
+
+// keys returns the JSON keys of a movie loaded with the projection
+func (p Projection) keys() []string {
+	keys := p.columns()
+
+	if p.Has(IncludeRatings) {
+		keys = append(keys, "average_score", "review_count")
+	}
+
+	if p.Has(IncludeImages) {
+		keys = append(keys, "images")
+	}
+
+	if p.Has(IncludeCredits) {
+		keys = append(keys, "credits")
+	}
+
+	return keys
+}
+
+func (movie *Movie) field(name string) any {
+	switch name {
+	case "id":
+		return &movie.ID
+	case "title":
+		return &movie.Title
+	case "year":
+		return &movie.Year
+	case "runtime":
+		return &movie.Runtime
+	case "genres":
+		return pq.Array(&movie.Genres)
+	case "version":
+		return &movie.Version
+	case "created_at":
+		return &movie.CreatedAt
+	default:
+		panic("unknown movie field: " + name)
+	}
+}
+
+// MarshalJSON only writes the keys of the projection the movie was loaded
+// with, movies that weren't loaded through a projection are written whole
+func (movie *Movie) MarshalJSON() ([]byte, error) {
+	type plain Movie
+
+	js, err := json.Marshal((*plain)(movie))
+	if err != nil || movie.keys == nil {
+		return js, err
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(js, &values); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	for _, key := range movie.keys {
+		// only the omitempty relations can be missing, an included relation
+		// without any rows is still written as an empty list
+		value, ok := values[key]
+		if !ok {
+			value = json.RawMessage("[]")
+		}
+
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+
+		name, _ := json.Marshal(key)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+func ValidateProjection(v *validator.Validator, p Projection) {
+	for _, field := range p.Fields {
+		v.Check(validator.In(field, MovieFields...), "fields", fmt.Sprintf("unknown field %q", field))
+	}
+
+	v.Check(validator.Unique(p.Fields), "fields", "must not contain duplicate values")
+
+	for _, include := range p.Includes {
+		v.Check(validator.In(include, MovieIncludes...), "include", fmt.Sprintf("unknown include %q", include))
+	}
+
+	v.Check(validator.Unique(p.Includes), "include", "must not contain duplicate values")
+}
@@ -0,0 +1,214 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+var (
+	ErrDuplicateReview = errors.New("duplicate review")
+)
+
+const (
+	duplicateReviewConstraint = "reviews_user_movie_key"
+)
+
+type Review struct {
+	ID      int64 `json:"id"`
+	MovieID int64 `json:"movie_id"`
+	UserID  int64 `json:"user_id"`
+
+	Score int32  `json:"score"`
+	Body  string `json:"body,omitempty"`
+
+	Version   int32     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ReviewModel struct {
+	DB *sql.DB
+}
+
+func (m ReviewModel) Insert(review *Review) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					INSERT INTO reviews
+					(movie_id, user_id, score, body)
+					VALUES
+					($1, $2, $3, $4)
+					RETURNING id, version, created_at, updated_at
+	`
+	args := []any{review.MovieID, review.UserID, review.Score, review.Body}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.Version, &review.CreatedAt, &review.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err, duplicateReviewConstraint) {
+			return ErrDuplicateReview
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Select returns the review with the given id, scoped to a movie
+func (m ReviewModel) Select(movieID, id int64) (*Review, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	var review Review
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					SELECT
+					id, movie_id, user_id, score, body, version, created_at, updated_at
+					FROM reviews
+					WHERE
+					id = $1 AND movie_id = $2
+	`
+
+	err := m.DB.QueryRowContext(ctx, query, id, movieID).Scan(
+		&review.ID,
+		&review.MovieID,
+		&review.UserID,
+		&review.Score,
+		&review.Body,
+		&review.Version,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+func (m ReviewModel) SelectForMovie(movieID int64, filters Filters) ([]*Review, MetaData, error) {
+	total := 0
+	reviews := []*Review{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := fmt.Sprintf(`
+					SELECT
+					count(*) OVER(), id, movie_id, user_id, score, body, version, created_at, updated_at
+					FROM reviews
+					WHERE
+					movie_id = $1
+					ORDER BY %s
+					LIMIT $2
+					OFFSET $3
+	`, filters.orderBy("id"))
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var review Review
+		err := rows.Scan(
+			&total,
+			&review.ID,
+			&review.MovieID,
+			&review.UserID,
+			&review.Score,
+			&review.Body,
+			&review.Version,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+		)
+		if err != nil {
+			return nil, MetaData{}, err
+		}
+
+		reviews = append(reviews, &review)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, MetaData{}, err
+	}
+
+	metadata := calculateMetaData(total, filters.Page, filters.PageSize)
+
+	return reviews, metadata, nil
+}
+
+func (m ReviewModel) Update(review *Review) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					UPDATE reviews
+					SET
+					score = $1, body = $2, updated_at = NOW(), version = version + 1
+					WHERE
+					version = $3
+					AND
+					id = $4
+					RETURNING version, updated_at
+	`
+	args := []any{review.Score, review.Body, review.Version, review.ID}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&review.Version, &review.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (m ReviewModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM reviews WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Score >= 1, "score", "must be at least 1")
+	v.Check(review.Score <= 10, "score", "must not be more than 10")
+
+	v.Check(len(review.Body) <= 10_000, "body", "must not be more than 10000 bytes long")
+}
@@ -0,0 +1,80 @@
+package data
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+func TestReviewInsert(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := ReviewModel{DB: db}
+
+	now := time.Now()
+	f.expect("INSERT INTO reviews").returns([]string{"id", "version", "created_at", "updated_at"}, []driver.Value{int64(5), int64(1), now, now})
+	f.expect("INSERT INTO reviews").fails(&pq.Error{Code: uniqueViolationCode, Constraint: duplicateReviewConstraint})
+
+	review := &Review{MovieID: 1, UserID: 2, Score: 8}
+	if err := m.Insert(review); err != nil {
+		t.Fatal(err)
+	}
+
+	if review.ID != 5 || review.Version != 1 {
+		t.Errorf("got %+v", review)
+	}
+
+	if err := m.Insert(&Review{MovieID: 1, UserID: 2, Score: 8}); !errors.Is(err, ErrDuplicateReview) {
+		t.Errorf("second review of the same movie: got %v, want ErrDuplicateReview", err)
+	}
+}
+
+func TestReviewUpdateConflict(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := ReviewModel{DB: db}
+
+	// no row comes back when the version moved on
+	f.expect("UPDATE reviews").returns([]string{"version", "updated_at"})
+
+	if err := m.Update(&Review{ID: 5, Score: 3, Version: 1}); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("got %v, want ErrEditConflict", err)
+	}
+}
+
+func TestReviewDelete(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := ReviewModel{DB: db}
+
+	f.expect("DELETE FROM reviews").affects(0)
+
+	if err := m.Delete(5); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got %v, want ErrRecordNotFound", err)
+	}
+
+	if err := m.Delete(0); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("invalid id: got %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestValidateReview(t *testing.T) {
+	tests := []struct {
+		review Review
+		valid  bool
+	}{
+		{Review{Score: 1}, true},
+		{Review{Score: 10, Body: "great"}, true},
+		{Review{Score: 0}, false},
+		{Review{Score: 11}, false},
+		{Review{Score: 5, Body: string(make([]byte, 10_001))}, false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		if ValidateReview(v, &tt.review); v.Valid() != tt.valid {
+			t.Errorf("score %d, %d bytes body: got valid %t", tt.review.Score, len(tt.review.Body), v.Valid())
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Revision is a snapshot of a movie as it was at a given version
+type Revision struct {
+	ID      int64 `json:"id"`
+	MovieID int64 `json:"movie_id"`
+	Version int32 `json:"version"`
+
+	Title   string   `json:"title"`
+	Year    int32    `json:"year"`
+	Runtime Runtime  `json:"runtime"`
+	Genres  []string `json:"genres"`
+
+	UserID    *int64    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Change holds the old and new value of a field that differs between
+// two revisions
+type Change struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// Diff returns the fields that changed going from r to other
+func (r *Revision) Diff(other *Revision) map[string]Change {
+	changes := make(map[string]Change)
+
+	if r.Title != other.Title {
+		changes["title"] = Change{From: r.Title, To: other.Title}
+	}
+
+	if r.Year != other.Year {
+		changes["year"] = Change{From: r.Year, To: other.Year}
+	}
+
+	if r.Runtime != other.Runtime {
+		changes["runtime"] = Change{From: r.Runtime, To: other.Runtime}
+	}
+
+	if !slices.Equal(r.Genres, other.Genres) {
+		changes["genres"] = Change{From: r.Genres, To: other.Genres}
+	}
+
+	return changes
+}
+
+// Apply copies the snapshot values of the revision onto the movie
+func (r *Revision) Apply(movie *Movie) {
+	movie.Title = r.Title
+	movie.Year = r.Year
+	movie.Runtime = r.Runtime
+	movie.Genres = slices.Clone(r.Genres)
+}
+
+type RevisionModel struct {
+	DB *sql.DB
+}
+
+// insertRevision records the current state of the movie, it is meant to
+// run in the same transaction as the write that produced the version
+func insertRevision(ctx context.Context, tx *sql.Tx, movie *Movie, userID int64) error {
+	query := `
+					INSERT INTO movie_revisions
+					(movie_id, version, title, year, runtime, genres, user_id)
+					VALUES
+					($1, $2, $3, $4, $5, $6, $7)
+	`
+	args := []any{movie.ID, movie.Version, movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), nullableID(userID)}
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (m RevisionModel) Select(movieID int64, version int32) (*Revision, error) {
+	var revision Revision
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					SELECT
+					id, movie_id, version, title, year, runtime, genres, user_id, created_at
+					FROM movie_revisions
+					WHERE
+					movie_id = $1 AND version = $2
+	`
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, version).Scan(
+		&revision.ID,
+		&revision.MovieID,
+		&revision.Version,
+		&revision.Title,
+		&revision.Year,
+		&revision.Runtime,
+		pq.Array(&revision.Genres),
+		&revision.UserID,
+		&revision.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+func (m RevisionModel) SelectForMovie(movieID int64, filters Filters) ([]*Revision, MetaData, error) {
+	total := 0
+	revisions := []*Revision{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := fmt.Sprintf(`
+					SELECT
+					count(*) OVER(), id, movie_id, version, title, year, runtime, genres, user_id, created_at
+					FROM movie_revisions
+					WHERE
+					movie_id = $1
+					ORDER BY %s
+					LIMIT $2
+					OFFSET $3
+	`, filters.orderBy("id"))
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var revision Revision
+		err := rows.Scan(
+			&total,
+			&revision.ID,
+			&revision.MovieID,
+			&revision.Version,
+			&revision.Title,
+			&revision.Year,
+			&revision.Runtime,
+			pq.Array(&revision.Genres),
+			&revision.UserID,
+			&revision.CreatedAt,
+		)
+		if err != nil {
+			return nil, MetaData{}, err
+		}
+
+		revisions = append(revisions, &revision)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, MetaData{}, err
+	}
+
+	metadata := calculateMetaData(total, filters.Page, filters.PageSize)
+
+	return revisions, metadata, nil
+}
+
+// nullableID maps the zero id, as used by anonymous users, to NULL
+func nullableID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id > 0}
+}
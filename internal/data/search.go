@@ -0,0 +1,154 @@
+package data
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+const (
+	// SortRelevance orders searches by how well the title matches
+	SortRelevance = "relevance"
+
+	defaultSearchLanguage = "simple"
+)
+
+// SearchLanguages are the text search configurations titles can be
+// searched with, each one has its own index on movies
+var SearchLanguages = []string{"simple", "english", "french", "german", "spanish", "italian", "portuguese"}
+
+// MovieSearch holds the criteria the movie listings are filtered by,
+// zero values leave a criterion out
+type MovieSearch struct {
+	Title    string
+	Genres   []string
+	Language string
+
+	YearMin    int
+	YearMax    int
+	RuntimeMin int
+	RuntimeMax int
+
+	// GenresAny matches movies with at least one of the genres, unlike
+	// Genres which requires all of them
+	GenresAny     []string
+	ExcludeGenres []string
+
+	CreatedAfter time.Time
+}
+
+// NormalizeGenres replaces every searched genre by its slug
+func (s *MovieSearch) NormalizeGenres(genres Vocabulary) {
+	s.Genres = genres.NormalizeAll(s.Genres)
+	s.GenresAny = genres.NormalizeAll(s.GenresAny)
+	s.ExcludeGenres = genres.NormalizeAll(s.ExcludeGenres)
+}
+
+func (s MovieSearch) language() string {
+	if validator.In(s.Language, SearchLanguages...) {
+		return s.Language
+	}
+
+	return defaultSearchLanguage
+}
+
+// clause returns the WHERE clause matching the search. Titles match on
+// full text search with the language's stemming, or on trigram similarity
+// to tolerate typos. Every criterion is a parameter, in the order of args,
+// and is skipped when it holds its zero value.
+func (s MovieSearch) clause() string {
+	return fmt.Sprintf(`
+				deleted_at IS NULL
+				AND
+				($1 = '' OR to_tsvector('%[1]s', title) @@ plainto_tsquery('%[1]s', $1) OR title %% $1)
+				AND
+				(genres @> $2 OR $2 = '{}')
+				AND
+				(year >= $3 OR $3 = 0)
+				AND
+				(year <= $4 OR $4 = 0)
+				AND
+				(runtime >= $5 OR $5 = 0)
+				AND
+				(runtime <= $6 OR $6 = 0)
+				AND
+				(genres && $7 OR $7 = '{}')
+				AND
+				NOT (genres && $8)
+				AND
+				(created_at > $9 OR $9 IS NULL)
+	`, s.language())
+}
+
+// args returns the parameters of clause
+func (s MovieSearch) args() []any {
+	var createdAfter *time.Time
+	if !s.CreatedAfter.IsZero() {
+		createdAfter = &s.CreatedAfter
+	}
+
+	return []any{
+		s.Title,
+		pq.Array(s.Genres),
+		s.YearMin,
+		s.YearMax,
+		s.RuntimeMin,
+		s.RuntimeMax,
+		pq.Array(s.GenresAny),
+		pq.Array(s.ExcludeGenres),
+		createdAfter,
+	}
+}
+
+// rank returns the relevance of a row to the searched title, the full
+// text rank is added to the trigram similarity so exact word matches come
+// before misspelled ones
+func (s MovieSearch) rank() string {
+	return fmt.Sprintf(
+		"(ts_rank(to_tsvector('%[1]s', title), plainto_tsquery('%[1]s', $1)) + similarity(title, $1))",
+		s.language(),
+	)
+}
+
+// orderBy returns the ORDER BY clause of a listing, which ends with a
+// stable id tiebreak
+func (s MovieSearch) orderBy(filters Filters) string {
+	if filters.Sort == SortRelevance {
+		return fmt.Sprintf("%s DESC, id ASC", s.rank())
+	}
+
+	return filters.orderBy("id")
+}
+
+func ValidateMovieSearch(v *validator.Validator, s MovieSearch, f Filters) {
+	v.Check(s.Language == "" || validator.In(s.Language, SearchLanguages...), "lang", "unsupported search language")
+
+	v.Check(s.YearMin >= 0, "year_min", "must not be negative")
+	v.Check(s.YearMax >= 0, "year_max", "must not be negative")
+	v.Check(s.YearMin == 0 || s.YearMax == 0 || s.YearMin <= s.YearMax, "year_min", "must not be greater than year_max")
+
+	v.Check(s.RuntimeMin >= 0, "runtime_min", "must not be negative")
+	v.Check(s.RuntimeMax >= 0, "runtime_max", "must not be negative")
+	v.Check(s.RuntimeMin == 0 || s.RuntimeMax == 0 || s.RuntimeMin <= s.RuntimeMax, "runtime_min", "must not be greater than runtime_max")
+
+	v.Check(validator.Unique(s.GenresAny), "genres_any", "must not contain duplicate values")
+	v.Check(validator.Unique(s.ExcludeGenres), "exclude_genres", "must not contain duplicate values")
+
+	for _, genre := range s.Genres {
+		v.Check(!slices.Contains(s.ExcludeGenres, genre), "exclude_genres", fmt.Sprintf("%q is also a required genre", genre))
+	}
+
+	v.Check(s.CreatedAfter.IsZero() || s.CreatedAfter.Before(time.Now()), "created_after", "must not be in the future")
+
+	if keys := f.sortKeys(); len(keys) > 1 {
+		v.Check(!slices.Contains(keys, SortRelevance), "sort", "relevance can't be combined with other sort keys")
+	}
+
+	if f.Sort == SortRelevance {
+		v.Check(s.Title != "", "sort", "relevance requires a title to search for")
+		v.Check(!f.Keyset, "sort", "relevance can't be used with cursor pagination")
+	}
+}
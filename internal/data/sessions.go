@@ -0,0 +1,317 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// SessionTouchInterval is how stale the last use of a session may get
+	// before it's written again, so requests don't each cost a write
+	SessionTouchInterval = 5 * time.Minute
+)
+
+// Session is a login, it owns the access and refresh tokens of a single
+// token family
+type Session struct {
+	ID     int64  `json:"id"`
+	UserID int64  `json:"-"`
+	Family []byte `json:"-"`
+
+	// IP and UserAgent are the ones the session was started from, only the
+	// address of the last use is kept
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	LastUsedIP string    `json:"last_used_ip,omitempty"`
+
+	// ClientID is the OAuth client the session was started by, its tokens
+	// only grant the Scopes the user consented to. First party sessions
+	// have neither.
+	ClientID *int64   `json:"-"`
+	Client   string   `json:"client,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+
+	Current bool `json:"current"`
+
+	// tokenHash is the hash of the token the session was looked up with,
+	// it's what gets revoked for tokens issued without a session
+	tokenHash []byte
+}
+
+// Stale reports whether the last use of the session is due for a write
+func (s *Session) Stale() bool {
+	return s.ID != 0 && time.Since(s.LastUsedAt) > SessionTouchInterval
+}
+
+type SessionModel struct {
+	DB *sql.DB
+}
+
+func insertSession(ctx context.Context, tx *sql.Tx, session *Session) error {
+	query := `
+					INSERT INTO sessions
+					(family, user_id, ip, user_agent, client_id, scopes)
+					VALUES
+					($1, $2, $3, $4, $5, $6)
+					RETURNING id, created_at, last_used_at
+	`
+	args := []any{session.Family, session.UserID, session.IP, session.UserAgent, session.ClientID, pq.Array(session.Scopes)}
+
+	return tx.QueryRowContext(ctx, query, args...).Scan(&session.ID, &session.CreatedAt, &session.LastUsedAt)
+}
+
+// GetForToken returns the user an authentication token belongs to along
+// with the session it was issued for. The scopes of a client's session are
+// narrowed down to the permissions the user still holds.
+func (m SessionModel) GetForToken(text string) (*User, *Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var user User
+	var id sql.NullInt64
+	var lastUsedAt sql.NullTime
+
+	hash := sha256.Sum256([]byte(text))
+	session := Session{tokenHash: hash[:]}
+
+	query := `
+					SELECT
+					users.id, users.name, users.email, users.password_hash, users.activated, users.created_at, users.version,
+					sessions.id, sessions.last_used_at, sessions.client_id,
+					CASE WHEN sessions.scopes IS NULL THEN NULL ELSE ARRAY(
+						SELECT permissions.code FROM permissions
+						INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+						WHERE users_permissions.user_id = users.id AND permissions.code = ANY(sessions.scopes)
+					) END
+					FROM users
+					INNER JOIN tokens
+					ON users.id = tokens.user_id
+					LEFT JOIN sessions
+					ON sessions.family = tokens.family
+					WHERE
+					tokens.hash = $1 AND
+					tokens.scope = $2 AND
+					tokens.expiry > $3
+	`
+	args := []any{hash[:], ScopeAuthentication, time.Now()}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.CreatedAt,
+		&user.Version,
+		&id,
+		&lastUsedAt,
+		&session.ClientID,
+		pq.Array(&session.Scopes),
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, ErrRecordNotFound
+		}
+
+		return nil, nil, err
+	}
+
+	session.ID = id.Int64
+	session.UserID = user.ID
+	session.LastUsedAt = lastUsedAt.Time
+
+	return &user, &session, nil
+}
+
+// SelectAllForUser returns the sessions of the user, most recently used
+// first
+func (m SessionModel) SelectAllForUser(userID int64) ([]*Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					SELECT
+					sessions.id, sessions.user_id, sessions.ip, sessions.user_agent, sessions.created_at, sessions.last_used_at,
+					sessions.last_used_ip, sessions.client_id, COALESCE(oauth_clients.name, ''), sessions.scopes
+					FROM sessions
+					LEFT JOIN oauth_clients
+					ON oauth_clients.id = sessions.client_id
+					WHERE
+					sessions.user_id = $1
+					AND
+					EXISTS (SELECT 1 FROM tokens WHERE tokens.family = sessions.family AND tokens.expiry > NOW())
+					ORDER BY sessions.last_used_at DESC, sessions.id DESC
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.IP,
+			&session.UserAgent,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.LastUsedIP,
+			&session.ClientID,
+			&session.Client,
+			pq.Array(&session.Scopes),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, &session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// Touch records a use of the session, it's a no-op when the session was
+// used recently enough
+func (m SessionModel) Touch(id int64, ip string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					UPDATE sessions
+					SET
+					last_used_at = NOW(), last_used_ip = $2
+					WHERE
+					id = $1 AND last_used_at < $3
+	`
+	args := []any{id, ip, time.Now().Add(-SessionTouchInterval)}
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// Delete revokes the session of the user and every token issued for it
+func (m SessionModel) Delete(userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Revoke ends the session, or only the token it was looked up with when
+// the token was issued without one
+func (m SessionModel) Revoke(session *Session) error {
+	if session.ID != 0 {
+		return m.Delete(session.UserID, session.ID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM tokens WHERE hash = $1`, session.tokenHash)
+	return err
+}
+
+// DeleteExpired deletes the expired tokens and then the sessions left
+// without any, it returns how many sessions were deleted
+func (m SessionModel) DeleteExpired() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tokens WHERE expiry < NOW()`); err != nil {
+		return 0, err
+	}
+
+	query := `
+					DELETE FROM sessions
+					WHERE
+					NOT EXISTS (SELECT 1 FROM tokens WHERE tokens.family = sessions.family)
+	`
+
+	result, err := tx.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, tx.Commit()
+}
+
+// DeleteAllForUser logs the user out everywhere, it returns the ids of
+// the sessions that were deleted
+func (m SessionModel) DeleteAllForUser(userID int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `DELETE FROM sessions WHERE user_id = $1 RETURNING id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query := `DELETE FROM tokens WHERE user_id = $1 AND scope = ANY($2)`
+	if _, err := tx.ExecContext(ctx, query, userID, pq.Array([]string{ScopeAuthentication, ScopeRefresh})); err != nil {
+		return nil, err
+	}
+
+	return ids, tx.Commit()
+}
@@ -0,0 +1,151 @@
+package data
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSessionStale(t *testing.T) {
+	tests := []struct {
+		name    string
+		session Session
+		want    bool
+	}{
+		{"used recently", Session{ID: 1, LastUsedAt: time.Now()}, false},
+		{"used a while ago", Session{ID: 1, LastUsedAt: time.Now().Add(-2 * SessionTouchInterval)}, true},
+		{"no session", Session{LastUsedAt: time.Now().Add(-2 * SessionTouchInterval)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.session.Stale(); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionRevokeWithoutSession(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := SessionModel{DB: db}
+
+	now := time.Now()
+	columns := []string{"id", "name", "email", "password_hash", "activated", "created_at", "version", "id", "last_used_at", "client_id", "array"}
+	f.expect("FROM users").returns(columns, []driver.Value{int64(2), "alice", "alice@example.com", []byte("hash"), true, now, int64(1), nil, nil, nil, nil})
+	revoke := f.expect("DELETE FROM tokens WHERE hash = $1")
+
+	user, session, err := m.GetForToken("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.ID != 2 || session.ID != 0 || session.UserID != 2 || session.ClientID != nil {
+		t.Fatalf("got user %+v, session %+v", user, session)
+	}
+
+	// a token issued without a session is revoked on its own
+	if err := m.Revoke(session); err != nil {
+		t.Fatal(err)
+	}
+
+	hash := sha256.Sum256([]byte("token"))
+	if len(revoke.args) != 1 || !bytes.Equal(revoke.args[0].([]byte), hash[:]) {
+		t.Errorf("revoked %v, want the hash of the token", revoke.args)
+	}
+}
+
+func TestSessionRevoke(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := SessionModel{DB: db}
+
+	deleted := f.expect("DELETE FROM sessions WHERE id = $1 AND user_id = $2").affects(1)
+	f.expect("DELETE FROM sessions WHERE id = $1 AND user_id = $2").affects(0)
+
+	if err := m.Revoke(&Session{ID: 5, UserID: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deleted.args) != 2 || deleted.args[0] != int64(5) || deleted.args[1] != int64(2) {
+		t.Errorf("got args %v", deleted.args)
+	}
+
+	// another user's session isn't theirs to delete
+	if err := m.Delete(3, 5); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got %v, want ErrRecordNotFound", err)
+	}
+
+	if err := m.Delete(2, 0); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("invalid id: got %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestSessionTouch(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := SessionModel{DB: db}
+
+	touched := f.expect("UPDATE sessions")
+
+	if err := m.Touch(5, "203.0.113.7"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(touched.args) != 3 || touched.args[0] != int64(5) || touched.args[1] != "203.0.113.7" {
+		t.Fatalf("got args %v", touched.args)
+	}
+
+	// only a session that wasn't used within the interval is written
+	cutoff := touched.args[2].(time.Time)
+	if d := time.Since(cutoff); d < SessionTouchInterval || d > SessionTouchInterval+time.Minute {
+		t.Errorf("cutoff is %v ago, want %v", d, SessionTouchInterval)
+	}
+}
+
+func TestSessionDeleteAllForUser(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := SessionModel{DB: db}
+
+	f.expect("DELETE FROM sessions WHERE user_id = $1 RETURNING id").returns([]string{"id"}, []driver.Value{int64(4)}, []driver.Value{int64(5)})
+	tokens := f.expect("DELETE FROM tokens WHERE user_id = $1")
+
+	ids, err := m.DeleteAllForUser(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ids) != 2 || ids[0] != 4 || ids[1] != 5 {
+		t.Errorf("got ids %v, want [4 5]", ids)
+	}
+
+	if len(tokens.args) != 2 || tokens.args[0] != int64(2) {
+		t.Errorf("got args %v", tokens.args)
+	}
+
+	if f.commits != 1 {
+		t.Errorf("got %d commits, want 1", f.commits)
+	}
+}
+
+func TestSessionDeleteExpired(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := SessionModel{DB: db}
+
+	f.expect("DELETE FROM tokens WHERE expiry < NOW()").affects(9)
+	f.expect("DELETE FROM sessions").affects(3)
+
+	deleted, err := m.DeleteExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted != 3 {
+		t.Errorf("got %d sessions deleted, want 3", deleted)
+	}
+
+	if f.commits != 1 {
+		t.Errorf("got %d commits, want 1", f.commits)
+	}
+}
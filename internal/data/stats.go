@@ -0,0 +1,184 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// StatBucket is the number of movies, and their average runtime, sharing
+// a histogram value
+type StatBucket struct {
+	Value          string  `json:"value"`
+	Count          int     `json:"count"`
+	AverageRuntime float64 `json:"average_runtime"`
+}
+
+// GenreYearCount is the number of movies of a genre released in a year
+type GenreYearCount struct {
+	Genre string `json:"genre"`
+	Year  int32  `json:"year"`
+	Count int    `json:"count"`
+}
+
+// MovieStats aggregates the movies matching a search
+type MovieStats struct {
+	Movies         int     `json:"movies"`
+	AverageRuntime float64 `json:"average_runtime"`
+	MinRuntime     int32   `json:"min_runtime"`
+	MaxRuntime     int32   `json:"max_runtime"`
+	AverageYear    float64 `json:"average_year"`
+	MinYear        int32   `json:"min_year"`
+	MaxYear        int32   `json:"max_year"`
+
+	ByGenre        []StatBucket     `json:"by_genre"`
+	ByYear         []StatBucket     `json:"by_year"`
+	ByDecade       []StatBucket     `json:"by_decade"`
+	ByRuntime      []StatBucket     `json:"by_runtime"`
+	ByGenreAndYear []GenreYearCount `json:"by_genre_and_year"`
+
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// statAggregates are what the histograms compute for each bucket
+const statAggregates = "count(*), round(avg(runtime), 1)::float8"
+
+// statsHistograms select a label, a count and an average runtime for each
+// histogram, grouped over the movies matching the search clause
+var statsHistograms = []struct {
+	query  string
+	bucket func(*MovieStats) *[]StatBucket
+}{
+	{
+		query: `
+				SELECT genre, count(*), round(avg(runtime), 1)::float8
+				FROM movies
+				CROSS JOIN LATERAL unnest(genres) AS genre
+				WHERE
+				%s
+				GROUP BY genre
+				ORDER BY count(*) DESC, genre ASC
+		`,
+		bucket: func(s *MovieStats) *[]StatBucket { return &s.ByGenre },
+	},
+	{
+		query: `
+				SELECT year::text, count(*), round(avg(runtime), 1)::float8
+				FROM movies
+				WHERE
+				%s
+				GROUP BY year
+				ORDER BY year ASC
+		`,
+		bucket: func(s *MovieStats) *[]StatBucket { return &s.ByYear },
+	},
+	{
+		query:  decadeBucket.query(statAggregates),
+		bucket: func(s *MovieStats) *[]StatBucket { return &s.ByDecade },
+	},
+	{
+		query:  runtimeBucket.query(statAggregates),
+		bucket: func(s *MovieStats) *[]StatBucket { return &s.ByRuntime },
+	},
+}
+
+// Stats aggregates the movies matching the search, the histograms use the
+// same buckets as the facets
+func (m MovieModel) Stats(search MovieSearch) (*MovieStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stats := MovieStats{GeneratedAt: time.Now().UTC()}
+
+	query := fmt.Sprintf(`
+				SELECT
+				count(*),
+				COALESCE(round(avg(runtime), 1), 0)::float8,
+				COALESCE(min(runtime), 0),
+				COALESCE(max(runtime), 0),
+				COALESCE(round(avg(year), 1), 0)::float8,
+				COALESCE(min(year), 0),
+				COALESCE(max(year), 0)
+				FROM movies
+				WHERE
+				%s
+	`, search.clause())
+
+	err := m.DB.QueryRowContext(ctx, query, search.args()...).Scan(
+		&stats.Movies,
+		&stats.AverageRuntime,
+		&stats.MinRuntime,
+		&stats.MaxRuntime,
+		&stats.AverageYear,
+		&stats.MinYear,
+		&stats.MaxYear,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, histogram := range statsHistograms {
+		buckets, err := m.statBuckets(ctx, fmt.Sprintf(histogram.query, search.clause()), search.args())
+		if err != nil {
+			return nil, err
+		}
+
+		*histogram.bucket(&stats) = buckets
+	}
+
+	if stats.ByGenreAndYear, err = m.genreYearCounts(ctx, search); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+func (m MovieModel) statBuckets(ctx context.Context, query string, args []any) ([]StatBucket, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []StatBucket{}
+	for rows.Next() {
+		var bucket StatBucket
+		if err := rows.Scan(&bucket.Value, &bucket.Count, &bucket.AverageRuntime); err != nil {
+			return nil, err
+		}
+
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, rows.Err()
+}
+
+func (m MovieModel) genreYearCounts(ctx context.Context, search MovieSearch) ([]GenreYearCount, error) {
+	query := fmt.Sprintf(`
+				SELECT genre, year, count(*)
+				FROM movies
+				CROSS JOIN LATERAL unnest(genres) AS genre
+				WHERE
+				%s
+				GROUP BY genre, year
+				ORDER BY genre ASC, year ASC
+	`, search.clause())
+
+	rows, err := m.DB.QueryContext(ctx, query, search.args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []GenreYearCount{}
+	for rows.Next() {
+		var count GenreYearCount
+		if err := rows.Scan(&count.Genre, &count.Year, &count.Count); err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
@@ -0,0 +1,40 @@
+package data
+
+import (
+	"database/sql/driver"
+	"testing"
+)
+
+func TestStatsBucketsMatchFacets(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := MovieModel{DB: db}
+
+	search := MovieSearch{}
+	f.expect("COALESCE(max(year), 0)").returns([]string{"count", "avg", "min", "max", "avg", "min", "max"},
+		[]driver.Value{int64(3), 112.5, int64(90), int64(150), 1995.5, int64(1972), int64(2019)})
+	f.expect("GROUP BY genre").returns([]string{"genre", "count", "avg"})
+	f.expect("GROUP BY year\n").returns([]string{"year", "count", "avg"})
+	decade := f.expect("GROUP BY year / 10").returns([]string{"decade", "count", "avg"},
+		[]driver.Value{"1970s", int64(1), 90.0},
+		[]driver.Value{"2010s", int64(2), 135.0})
+	runtime := f.expect("GROUP BY runtime / 30").returns([]string{"runtime", "count", "avg"},
+		[]driver.Value{"90-119 mins", int64(1), 90.0})
+	f.expect("GROUP BY genre, year").returns([]string{"genre", "year", "count"})
+
+	stats, err := m.Stats(search)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Movies != 3 || len(stats.ByDecade) != 2 || stats.ByDecade[1].Value != "2010s" || stats.ByRuntime[0].AverageRuntime != 90 {
+		t.Errorf("got %+v", stats)
+	}
+
+	// the facets are grouped the way the histograms are
+	f.expect(decade.query).returns([]string{"value", "count"})
+	f.expect(runtime.query).returns([]string{"value", "count"})
+
+	if _, err := m.Facets(search, []string{FacetDecade, FacetRuntime}); err != nil {
+		t.Fatal(err)
+	}
+}
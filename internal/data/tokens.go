@@ -6,8 +6,10 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/yousifsabah0/blackbox/internal/validator"
 )
 
@@ -15,14 +17,44 @@ const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
 	ScopePasswordReset  = "password-reset"
+	ScopeRefresh        = "refresh"
 )
 
+var (
+	// ErrTokenReused is returned when a refresh token that was already
+	// rotated is presented again, its whole session is revoked by then
+	ErrTokenReused = errors.New("refresh token reused")
+)
+
+// ReuseError is the ErrTokenReused Rotate returns, it names the session
+// that was revoked
+type ReuseError struct {
+	SessionID int64
+}
+
+func (e *ReuseError) Error() string {
+	return ErrTokenReused.Error()
+}
+
+func (e *ReuseError) Unwrap() error {
+	return ErrTokenReused
+}
+
 type Token struct {
 	Text   string    `json:"token"`
 	Hash   []byte    `json:"-"`
 	UserID int64     `json:"-"`
 	Expiry time.Time `json:"expiry"`
 	Scope  string    `json:"-"`
+
+	// Family ties the access and refresh tokens issued from a single login
+	// together, so they can be revoked at once
+	Family []byte `json:"-"`
+
+	// SessionID is the session a token of a family was issued for, Scopes
+	// are the session's
+	SessionID int64    `json:"-"`
+	Scopes    []string `json:"-"`
 }
 
 type TokenModel struct {
@@ -38,15 +70,19 @@ func (t TokenModel) Insert(token *Token) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
+	return insertToken(ctx, t.DB, token)
+}
+
+func insertToken(ctx context.Context, db execer, token *Token) error {
 	query := `
 					INSERT INTO tokens
-					(hash, user_id, expiry, scope)
+					(hash, user_id, expiry, scope, family)
 					VALUES
-					($1, $2, $3, $4)
+					($1, $2, $3, $4, $5)
 	`
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.Family}
 
-	_, err := t.DB.ExecContext(ctx, query, args...)
+	_, err := db.ExecContext(ctx, query, args...)
 	return err
 }
 
@@ -63,6 +99,143 @@ func (t TokenModel) New(userID int64, expiry time.Duration, scope string) (*Toke
 	return token, nil
 }
 
+// NewPair starts a session with a short-lived access token together with
+// the refresh token that renews it, both in the session's family. A zero
+// accessExpiry leaves the access token out, for when it's signed instead
+// of stored, and a zero refreshExpiry leaves the refresh token out.
+func (t TokenModel) NewPair(session *Session, accessExpiry, refreshExpiry time.Duration) (*Token, *Token, error) {
+	session.Family = make([]byte, 16)
+	if _, err := rand.Read(session.Family); err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	if err := insertSession(ctx, tx, session); err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := insertPair(ctx, tx, session.UserID, session.ID, session.Family, accessExpiry, refreshExpiry)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return access, refresh, tx.Commit()
+}
+
+// Rotate trades a refresh token for a new pair in the same family. The
+// presented token is kept, marked as rotated, until it expires: presenting
+// it again means it leaked, and the whole session is revoked. Only the
+// OAuth client the session was started by can rotate its tokens, a nil
+// clientID stands for the first party.
+func (t TokenModel) Rotate(text string, clientID *int64, accessExpiry, refreshExpiry time.Duration) (*Token, *Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	hash := sha256.Sum256([]byte(text))
+
+	var userID, sessionID int64
+	var family []byte
+	var rotated bool
+	var scopes []string
+
+	query := `
+					SELECT tokens.user_id, tokens.family, tokens.rotated_at IS NOT NULL, sessions.id, sessions.scopes
+					FROM tokens
+					INNER JOIN sessions
+					ON sessions.family = tokens.family
+					WHERE
+					tokens.hash = $1 AND tokens.scope = $2 AND tokens.expiry > NOW()
+					AND
+					sessions.client_id IS NOT DISTINCT FROM $3
+					FOR UPDATE OF tokens
+	`
+
+	err = tx.QueryRowContext(ctx, query, hash[:], ScopeRefresh, clientID).Scan(&userID, &family, &rotated, &sessionID, pq.Array(&scopes))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, ErrRecordNotFound
+		}
+
+		return nil, nil, err
+	}
+
+	if rotated {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE family = $1`, family); err != nil {
+			return nil, nil, err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return nil, nil, err
+		}
+
+		return nil, nil, &ReuseError{SessionID: sessionID}
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE tokens SET rotated_at = NOW() WHERE hash = $1`, hash[:]); err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE sessions SET last_used_at = NOW() WHERE id = $1`, sessionID); err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := insertPair(ctx, tx, userID, sessionID, family, accessExpiry, refreshExpiry)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refresh.Scopes = scopes
+
+	return access, refresh, tx.Commit()
+}
+
+func insertPair(ctx context.Context, tx *sql.Tx, userID, sessionID int64, family []byte, accessExpiry, refreshExpiry time.Duration) (*Token, *Token, error) {
+	var tokens []*Token
+	var access, refresh *Token
+	var err error
+
+	if refreshExpiry > 0 {
+		if refresh, err = generateToken(userID, refreshExpiry, ScopeRefresh); err != nil {
+			return nil, nil, err
+		}
+
+		tokens = append(tokens, refresh)
+	}
+
+	if accessExpiry > 0 {
+		if access, err = generateToken(userID, accessExpiry, ScopeAuthentication); err != nil {
+			return nil, nil, err
+		}
+
+		tokens = append(tokens, access)
+	}
+
+	for _, token := range tokens {
+		token.Family = family
+		token.SessionID = sessionID
+
+		if err := insertToken(ctx, tx, token); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return access, refresh, nil
+}
+
 func (t TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
@@ -0,0 +1,112 @@
+package data
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+var rotateColumns = []string{"user_id", "family", "rotated", "id", "scopes"}
+
+func TestTokenRotate(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := TokenModel{DB: db}
+
+	family := []byte("family")
+	hash := sha256.Sum256([]byte("refresh"))
+
+	lookup := f.expect("FOR UPDATE OF tokens").returns(rotateColumns, []driver.Value{int64(2), family, false, int64(5), nil})
+	rotated := f.expect("UPDATE tokens SET rotated_at = NOW()")
+	touched := f.expect("UPDATE sessions SET last_used_at = NOW()")
+	refreshInsert := f.expect("INSERT INTO tokens")
+	accessInsert := f.expect("INSERT INTO tokens")
+
+	access, refresh, err := m.Rotate("refresh", nil, time.Minute, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lookup.args[2] != nil {
+		t.Errorf("first party rotation: got client %v, want nil", lookup.args[2])
+	}
+
+	if !bytes.Equal(rotated.args[0].([]byte), hash[:]) {
+		t.Errorf("rotated %v, want the presented token", rotated.args[0])
+	}
+
+	if touched.args[0] != int64(5) {
+		t.Errorf("touched session %v, want 5", touched.args[0])
+	}
+
+	// the new pair stays in the family of the presented token
+	for _, token := range []*Token{access, refresh} {
+		if token.UserID != 2 || token.SessionID != 5 || !bytes.Equal(token.Family, family) {
+			t.Errorf("got token %+v", token)
+		}
+	}
+
+	if access.Scope != ScopeAuthentication || refresh.Scope != ScopeRefresh || refresh.Text == "refresh" {
+		t.Errorf("got access %+v, refresh %+v", access, refresh)
+	}
+
+	if !bytes.Equal(refreshInsert.args[4].([]byte), family) || !bytes.Equal(accessInsert.args[4].([]byte), family) {
+		t.Errorf("inserted families %v and %v", refreshInsert.args[4], accessInsert.args[4])
+	}
+
+	if f.commits != 1 {
+		t.Errorf("got %d commits, want 1", f.commits)
+	}
+}
+
+func TestTokenRotateReuse(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := TokenModel{DB: db}
+
+	family := []byte("family")
+
+	f.expect("FOR UPDATE OF tokens").returns(rotateColumns, []driver.Value{int64(2), family, true, int64(5), nil})
+	revoked := f.expect("DELETE FROM sessions WHERE family = $1")
+
+	_, _, err := m.Rotate("refresh", nil, time.Minute, time.Hour)
+	if !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("got %v, want ErrTokenReused", err)
+	}
+
+	var reuse *ReuseError
+	if !errors.As(err, &reuse) || reuse.SessionID != 5 {
+		t.Errorf("got %#v, want the session 5 to be named", err)
+	}
+
+	if !bytes.Equal(revoked.args[0].([]byte), family) {
+		t.Errorf("revoked family %v, want %v", revoked.args[0], family)
+	}
+
+	// the revocation has to stick even though no pair is issued
+	if f.commits != 1 {
+		t.Errorf("got %d commits, want 1", f.commits)
+	}
+}
+
+func TestTokenRotateUnknown(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := TokenModel{DB: db}
+
+	clientID := int64(7)
+	lookup := f.expect("FOR UPDATE OF tokens").returns(rotateColumns)
+
+	if _, _, err := m.Rotate("refresh", &clientID, time.Minute, time.Hour); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got %v, want ErrRecordNotFound", err)
+	}
+
+	// only the client the session was started by may rotate its tokens
+	if lookup.args[2] != int64(7) {
+		t.Errorf("got client %v, want 7", lookup.args[2])
+	}
+
+	if f.commits != 0 {
+		t.Errorf("got %d commits, want none", f.commits)
+	}
+}
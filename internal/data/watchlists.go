@@ -0,0 +1,252 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+var (
+	ErrDuplicateWatchlistEntry = errors.New("duplicate watchlist entry")
+)
+
+const (
+	duplicateWatchlistConstraint = "watchlist_pkey"
+)
+
+type WatchlistEntry struct {
+	Movie   *Movie    `json:"movie"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+type HistoryEntry struct {
+	ID        int64     `json:"id"`
+	Movie     *Movie    `json:"movie"`
+	WatchedAt time.Time `json:"watched_at"`
+}
+
+type WatchlistModel struct {
+	DB *sql.DB
+}
+
+func (m WatchlistModel) Add(userID, movieID int64) (*WatchlistEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					INSERT INTO watchlist
+					(user_id, movie_id)
+					VALUES
+					($1, $2)
+					RETURNING added_at
+	`
+
+	entry := &WatchlistEntry{}
+	if err := m.DB.QueryRowContext(ctx, query, userID, movieID).Scan(&entry.AddedAt); err != nil {
+		if isUniqueViolation(err, duplicateWatchlistConstraint) {
+			return nil, ErrDuplicateWatchlistEntry
+		}
+
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (m WatchlistModel) Remove(userID, movieID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `DELETE FROM watchlist WHERE user_id = $1 AND movie_id = $2`
+
+	result, err := m.DB.ExecContext(ctx, query, userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m WatchlistModel) SelectForUser(userID int64, filters Filters) ([]*WatchlistEntry, MetaData, error) {
+	total := 0
+	entries := []*WatchlistEntry{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := fmt.Sprintf(`
+					SELECT
+					count(*) OVER(), watchlist.added_at,
+					movies.id, movies.title, movies.year, movies.runtime, movies.genres, movies.version, movies.created_at,
+					COALESCE(ratings.average, 0), ratings.count
+					FROM watchlist
+					INNER JOIN movies ON movies.id = watchlist.movie_id
+					LEFT JOIN LATERAL (%s) ratings ON true
+					WHERE
+					watchlist.user_id = $1 AND movies.deleted_at IS NULL
+					ORDER BY %s
+					LIMIT $2
+					OFFSET $3
+	`, ratingsQuery, filters.orderBy("movies.id"))
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry := WatchlistEntry{Movie: &Movie{}}
+		err := rows.Scan(
+			&total,
+			&entry.AddedAt,
+			&entry.Movie.ID,
+			&entry.Movie.Title,
+			&entry.Movie.Year,
+			&entry.Movie.Runtime,
+			pq.Array(&entry.Movie.Genres),
+			&entry.Movie.Version,
+			&entry.Movie.CreatedAt,
+			&entry.Movie.AverageScore,
+			&entry.Movie.ReviewCount,
+		)
+		if err != nil {
+			return nil, MetaData{}, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, MetaData{}, err
+	}
+
+	metadata := calculateMetaData(total, filters.Page, filters.PageSize)
+
+	return entries, metadata, nil
+}
+
+type HistoryModel struct {
+	DB *sql.DB
+}
+
+func (m HistoryModel) Insert(userID int64, entry *HistoryEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `
+					INSERT INTO watch_history
+					(user_id, movie_id, watched_at)
+					VALUES
+					($1, $2, $3)
+					RETURNING id
+	`
+
+	return m.DB.QueryRowContext(ctx, query, userID, entry.Movie.ID, entry.WatchedAt).Scan(&entry.ID)
+}
+
+func (m HistoryModel) Delete(userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := `DELETE FROM watch_history WHERE id = $1 AND user_id = $2`
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m HistoryModel) SelectForUser(userID int64, filters Filters) ([]*HistoryEntry, MetaData, error) {
+	total := 0
+	entries := []*HistoryEntry{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := fmt.Sprintf(`
+					SELECT
+					count(*) OVER(), watch_history.id, watch_history.watched_at,
+					movies.id, movies.title, movies.year, movies.runtime, movies.genres, movies.version, movies.created_at,
+					COALESCE(ratings.average, 0), ratings.count
+					FROM watch_history
+					INNER JOIN movies ON movies.id = watch_history.movie_id
+					LEFT JOIN LATERAL (%s) ratings ON true
+					WHERE
+					watch_history.user_id = $1 AND movies.deleted_at IS NULL
+					ORDER BY %s
+					LIMIT $2
+					OFFSET $3
+	`, ratingsQuery, filters.orderBy("watch_history.id"))
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, MetaData{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry := HistoryEntry{Movie: &Movie{}}
+		err := rows.Scan(
+			&total,
+			&entry.ID,
+			&entry.WatchedAt,
+			&entry.Movie.ID,
+			&entry.Movie.Title,
+			&entry.Movie.Year,
+			&entry.Movie.Runtime,
+			pq.Array(&entry.Movie.Genres),
+			&entry.Movie.Version,
+			&entry.Movie.CreatedAt,
+			&entry.Movie.AverageScore,
+			&entry.Movie.ReviewCount,
+		)
+		if err != nil {
+			return nil, MetaData{}, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, MetaData{}, err
+	}
+
+	metadata := calculateMetaData(total, filters.Page, filters.PageSize)
+
+	return entries, metadata, nil
+}
+
+func ValidateHistoryEntry(v *validator.Validator, entry *HistoryEntry) {
+	v.Check(!entry.WatchedAt.IsZero(), "watched_at", "must be provided")
+	v.Check(entry.WatchedAt.Before(time.Now().Add(time.Minute)), "watched_at", "must not be in the future")
+}
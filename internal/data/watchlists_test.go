@@ -0,0 +1,93 @@
+package data
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+func TestWatchlistAdd(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := WatchlistModel{DB: db}
+
+	now := time.Now()
+	f.expect("INSERT INTO watchlist").returns([]string{"added_at"}, []driver.Value{now})
+	f.expect("INSERT INTO watchlist").fails(&pq.Error{Code: uniqueViolationCode, Constraint: duplicateWatchlistConstraint})
+
+	entry, err := m.Add(2, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !entry.AddedAt.Equal(now) {
+		t.Errorf("added at %v, want %v", entry.AddedAt, now)
+	}
+
+	if _, err := m.Add(2, 7); !errors.Is(err, ErrDuplicateWatchlistEntry) {
+		t.Errorf("got %v, want ErrDuplicateWatchlistEntry", err)
+	}
+}
+
+func TestWatchlistRemove(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := WatchlistModel{DB: db}
+
+	removed := f.expect("DELETE FROM watchlist").affects(1)
+	f.expect("DELETE FROM watchlist").affects(0)
+
+	if err := m.Remove(2, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []driver.Value{int64(2), int64(7)}; !reflect.DeepEqual(removed.args, want) {
+		t.Errorf("removed with %v, want %v", removed.args, want)
+	}
+
+	if err := m.Remove(2, 7); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestHistoryDeleteIsScopedToTheUser(t *testing.T) {
+	db, f := newFakeDB(t)
+	m := HistoryModel{DB: db}
+
+	deleted := f.expect("DELETE FROM watch_history WHERE id = $1 AND user_id = $2").affects(0)
+
+	if err := m.Delete(3, 9); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got %v, want ErrRecordNotFound", err)
+	}
+
+	if want := []driver.Value{int64(9), int64(3)}; !reflect.DeepEqual(deleted.args, want) {
+		t.Errorf("deleted with %v, want %v", deleted.args, want)
+	}
+
+	if err := m.Delete(3, 0); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("invalid id: got %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestValidateHistoryEntry(t *testing.T) {
+	tests := []struct {
+		name      string
+		watchedAt time.Time
+		valid     bool
+	}{
+		{"past", time.Now().Add(-time.Hour), true},
+		{"now", time.Now(), true},
+		{"missing", time.Time{}, false},
+		{"future", time.Now().Add(time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		if ValidateHistoryEntry(v, &HistoryEntry{WatchedAt: tt.watchedAt}); v.Valid() != tt.valid {
+			t.Errorf("%s: got valid %t, want %t", tt.name, v.Valid(), tt.valid)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+
+	// VariantOriginal is the uploaded file as it was received
+	VariantOriginal = "original"
+
+	MinDimension = 100
+	MaxDimension = 8000
+
+	// MaxPixels caps the area of an image, a decoded image takes 4 bytes
+	// per pixel and both sides can be within MaxDimension while the image
+	// is still too large to decode
+	MaxPixels = 40_000_000
+
+	jpegQuality = 85
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+
+	Formats = []string{FormatJPEG, FormatPNG}
+
+	contentTypes = map[string]string{
+		"image/jpeg": FormatJPEG,
+		"image/png":  FormatPNG,
+	}
+)
+
+// Variant is a resized copy of an image, it's never wider than Width
+type Variant struct {
+	Name  string
+	Width int
+}
+
+// Variants are generated for every uploaded image
+var Variants = []Variant{
+	{Name: "small", Width: 185},
+	{Name: "medium", Width: 500},
+	{Name: "large", Width: 1280},
+}
+
+// VariantNames lists the original and every generated variant
+func VariantNames() []string {
+	names := []string{VariantOriginal}
+	for _, variant := range Variants {
+		names = append(names, variant.Name)
+	}
+
+	return names
+}
+
+// Upload is a validated image, Body holds the uploaded bytes
+type Upload struct {
+	Format string
+	Width  int
+	Height int
+	Body   []byte
+}
+
+// ContentType returns the media type of the given format
+func ContentType(format string) string {
+	return "image/" + format
+}
+
+// Inspect sniffs the content type of body and reads its dimensions
+// without decoding the whole image, declared is the content type the
+// client sent and must agree with the sniffed one when set
+func Inspect(v *validator.Validator, body []byte, declared string) *Upload {
+	sniffed := http.DetectContentType(body)
+
+	format, ok := contentTypes[sniffed]
+	if !ok {
+		v.AddErrors("image", "must be a jpeg or png image")
+		return nil
+	}
+
+	if declared != "" && declared != "application/octet-stream" {
+		v.Check(declared == sniffed, "image", fmt.Sprintf("content type %q does not match the file contents", declared))
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		v.AddErrors("image", "could not be decoded")
+		return nil
+	}
+
+	v.Check(config.Width >= MinDimension && config.Height >= MinDimension, "image", fmt.Sprintf("must be at least %dx%d pixels", MinDimension, MinDimension))
+	v.Check(config.Width <= MaxDimension && config.Height <= MaxDimension, "image", fmt.Sprintf("must not be larger than %dx%d pixels", MaxDimension, MaxDimension))
+	v.Check(config.Width*config.Height <= MaxPixels, "image", fmt.Sprintf("must not have more than %d pixels", MaxPixels))
+
+	return &Upload{
+		Format: format,
+		Width:  config.Width,
+		Height: config.Height,
+		Body:   body,
+	}
+}
+
+// Generate decodes the upload and encodes every variant in the upload's
+// format, keyed by variant name. Uploads the variants can't be resized
+// from directly are converted to RGBA once and every variant is resized
+// from that copy.
+func Generate(upload *Upload) (map[string][]byte, error) {
+	decoded, _, err := image.Decode(bytes.NewReader(upload.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	src := resizable(decoded)
+
+	variants := make(map[string][]byte, len(Variants))
+	for _, variant := range Variants {
+		var buf bytes.Buffer
+		if err := Encode(&buf, Resize(src, variant.Width), upload.Format); err != nil {
+			return nil, err
+		}
+
+		variants[variant.Name] = buf.Bytes()
+	}
+
+	return variants, nil
+}
+
+func Encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case FormatJPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	case FormatPNG:
+		return png.Encode(w, img)
+	default:
+		return ErrUnsupportedFormat
+	}
+}
+
+// Resize scales src down to the given width, keeping its aspect ratio.
+// Every destination pixel is the average of the source pixels it covers.
+// Images that are already narrow enough are returned as they are.
+// *image.RGBA, *image.NRGBA and *image.YCbCr images, what the decoders
+// return for most files, are read as they are, other images are converted
+// to RGBA first and callers resizing them more than once should convert
+// them themselves.
+func Resize(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	if width >= bounds.Dx() {
+		return src
+	}
+
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+
+	add := sampler(resizable(src))
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0, y1 := span(y, height, bounds.Dy())
+
+		for x := 0; x < width; x++ {
+			x0, x1 := span(x, width, bounds.Dx())
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					add(&sum, bounds.Min.X+sx, bounds.Min.Y+sy)
+				}
+			}
+
+			n := (y1 - y0) * (x1 - x0)
+			offset := y*dst.Stride + x*4
+			for c := 0; c < 4; c++ {
+				dst.Pix[offset+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+
+	return dst
+}
+
+// resizable returns img if Resize can read it as it is, or a copy of it
+// converted to RGBA
+func resizable(img image.Image) image.Image {
+	switch img.(type) {
+	case *image.RGBA, *image.NRGBA, *image.YCbCr:
+		return img
+	default:
+		return toRGBA(img)
+	}
+}
+
+// sampler returns a func adding the alpha-premultiplied color of the pixel
+// at x, y to sum, img must be one of the images resizable returns as they
+// are
+func sampler(img image.Image) func(sum *[4]int, x, y int) {
+	switch img := img.(type) {
+	case *image.NRGBA:
+		return func(sum *[4]int, x, y int) {
+			px := img.Pix[img.PixOffset(x, y):]
+			a := int(px[3])
+			for c := 0; c < 3; c++ {
+				sum[c] += (int(px[c])*a + 127) / 255
+			}
+			sum[3] += a
+		}
+	case *image.YCbCr:
+		return func(sum *[4]int, x, y int) {
+			ci := img.COffset(x, y)
+			r, g, b := color.YCbCrToRGB(img.Y[img.YOffset(x, y)], img.Cb[ci], img.Cr[ci])
+			sum[0] += int(r)
+			sum[1] += int(g)
+			sum[2] += int(b)
+			sum[3] += 0xff
+		}
+	default:
+		rgba := img.(*image.RGBA)
+		return func(sum *[4]int, x, y int) {
+			px := rgba.Pix[rgba.PixOffset(x, y):]
+			for c := 0; c < 4; c++ {
+				sum[c] += int(px[c])
+			}
+		}
+	}
+}
+
+// toRGBA returns img as an *image.RGBA, copying it unless it already is
+// one
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+
+	bounds := img.Bounds()
+
+	rgba := image.NewRGBA(bounds)
+	draw.Draw(rgba, bounds, img, bounds.Min, draw.Src)
+
+	return rgba
+}
+
+// span returns the range of source pixels covered by the i-th of n
+// destination pixels
+func span(i, n, size int) (int, int) {
+	start := i * size / n
+	end := (i + 1) * size / n
+	if end <= start {
+		end = start + 1
+	}
+
+	return start, end
+}
@@ -0,0 +1,174 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/yousifsabah0/blackbox/internal/validator"
+)
+
+func solid(r image.Rectangle, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	return img
+}
+
+func TestResize(t *testing.T) {
+	c := color.RGBA{R: 200, G: 100, B: 50, A: 255}
+
+	tests := []struct {
+		name          string
+		src           image.Image
+		width         int
+		wantW, wantH  int
+		wantUnchanged bool
+	}{
+		{name: "downscale", src: solid(image.Rect(0, 0, 400, 200), c), width: 100, wantW: 100, wantH: 50},
+		{name: "offset bounds", src: solid(image.Rect(0, 0, 400, 200), c).SubImage(image.Rect(100, 50, 300, 150)), width: 50, wantW: 50, wantH: 25},
+		{name: "paletted", src: image.NewPaletted(image.Rect(0, 0, 300, 300), color.Palette{c}), width: 30, wantW: 30, wantH: 30},
+		{name: "narrow enough", src: solid(image.Rect(0, 0, 80, 80), c), width: 100, wantUnchanged: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := Resize(tt.src, tt.width)
+
+			if tt.wantUnchanged {
+				if dst != tt.src {
+					t.Fatal("expected the source image back")
+				}
+				return
+			}
+
+			bounds := dst.Bounds()
+			if bounds.Dx() != tt.wantW || bounds.Dy() != tt.wantH {
+				t.Fatalf("got %dx%d, want %dx%d", bounds.Dx(), bounds.Dy(), tt.wantW, tt.wantH)
+			}
+
+			for _, p := range []image.Point{bounds.Min, bounds.Max.Sub(image.Pt(1, 1))} {
+				if got := color.RGBAModel.Convert(dst.At(p.X, p.Y)); got != c {
+					t.Errorf("pixel %v: got %v, want %v", p, got, c)
+				}
+			}
+		})
+	}
+}
+
+func TestResizeReadsDecodedImages(t *testing.T) {
+	bounds := image.Rect(0, 0, 301, 203)
+
+	nrgba := image.NewNRGBA(bounds)
+	ycbcr := image.NewYCbCr(bounds, image.YCbCrSubsampleRatio420)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			nrgba.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: uint8(x ^ y), A: uint8(x + y)})
+
+			ycbcr.Y[ycbcr.YOffset(x, y)] = uint8(x + y)
+			ycbcr.Cb[ycbcr.COffset(x, y)] = uint8(x)
+			ycbcr.Cr[ycbcr.COffset(x, y)] = uint8(y)
+		}
+	}
+
+	// resizing them as they are gives what resizing an RGBA copy gives
+	for _, src := range []image.Image{nrgba, ycbcr.SubImage(image.Rect(10, 20, 250, 200))} {
+		got, want := Resize(src, 37).(*image.RGBA), Resize(toRGBA(src), 37).(*image.RGBA)
+
+		if got.Bounds() != want.Bounds() {
+			t.Fatalf("%T: got bounds %v, want %v", src, got.Bounds(), want.Bounds())
+		}
+
+		for i := range got.Pix {
+			if d := int(got.Pix[i]) - int(want.Pix[i]); d < -1 || d > 1 {
+				t.Fatalf("%T: byte %d is %d, want %d", src, i, got.Pix[i], want.Pix[i])
+			}
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, solid(image.Rect(0, 0, 1600, 900), color.RGBA{A: 255})); err != nil {
+		t.Fatal(err)
+	}
+
+	v := validator.New()
+	upload := Inspect(v, buf.Bytes(), "image/png")
+	if !v.Valid() {
+		t.Fatal(v.Errors)
+	}
+
+	variants, err := Generate(upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, variant := range Variants {
+		config, format, err := image.DecodeConfig(bytes.NewReader(variants[variant.Name]))
+		if err != nil {
+			t.Fatalf("%s: %v", variant.Name, err)
+		}
+
+		if format != FormatPNG || config.Width != variant.Width {
+			t.Errorf("%s: got a %d pixels wide %s, want a %d pixels wide png", variant.Name, config.Width, format, variant.Width)
+		}
+	}
+}
+
+func TestInspectRejectsMismatchedContentType(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, solid(image.Rect(0, 0, 200, 200), color.RGBA{A: 255})); err != nil {
+		t.Fatal(err)
+	}
+
+	v := validator.New()
+	if Inspect(v, buf.Bytes(), "image/jpeg"); v.Valid() {
+		t.Error("expected a validation error")
+	}
+}
+
+// pngHeader returns the start of a png of the given size, enough for its
+// size to be read
+func pngHeader(width, height int) []byte {
+	ihdr := make([]byte, 0, 17)
+	ihdr = append(ihdr, "IHDR"...)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, uint32(width))
+	ihdr = binary.BigEndian.AppendUint32(ihdr, uint32(height))
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+
+	header := []byte("\x89PNG\r\n\x1a\n")
+	header = binary.BigEndian.AppendUint32(header, 13)
+	header = append(header, ihdr...)
+	return binary.BigEndian.AppendUint32(header, crc32.ChecksumIEEE(ihdr))
+}
+
+func TestInspectDimensions(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		valid         bool
+	}{
+		{"valid", 1920, 1080, true},
+		{"too small", 1920, 50, false},
+		{"too wide", 9000, 1080, false},
+		{"too many pixels", 7000, 7000, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			if Inspect(v, pngHeader(tt.width, tt.height), ""); v.Valid() != tt.valid {
+				t.Errorf("got valid %v, want %v: %v", v.Valid(), tt.valid, v.Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	HS256 = "HS256"
+	EdDSA = "EdDSA"
+
+	// minSecretBytes is the shortest HS256 secret accepted, shorter ones
+	// can be brute forced from a single token
+	minSecretBytes = 32
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+// Claims are what an access token carries about its user, enough to
+// authenticate and authorize a request without a database lookup
+type Claims struct {
+	Subject     string   `json:"sub"`
+	SessionID   int64    `json:"sid,omitempty"`
+	ClientID    int64    `json:"cid,omitempty"`
+	Activated   bool     `json:"act"`
+	Permissions []string `json:"perms"`
+	IssuedAt    int64    `json:"iat"`
+	ExpiresAt   int64    `json:"exp"`
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Type      string `json:"typ"`
+}
+
+// Key signs and verifies tokens with a single algorithm, tokens name the
+// key they were signed with in their kid header
+type Key struct {
+	ID        string
+	Algorithm string
+
+	secret  []byte
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+func NewHMACKey(id string, secret []byte) (Key, error) {
+	if len(secret) < minSecretBytes {
+		return Key{}, fmt.Errorf("key %q: HS256 secrets must be at least %d bytes long", id, minSecretBytes)
+	}
+
+	return Key{ID: id, Algorithm: HS256, secret: secret}, nil
+}
+
+// NewEd25519Key derives the key pair from a 32 bytes seed
+func NewEd25519Key(id string, seed []byte) (Key, error) {
+	if len(seed) != ed25519.SeedSize {
+		return Key{}, fmt.Errorf("key %q: EdDSA seeds must be %d bytes long", id, ed25519.SeedSize)
+	}
+
+	private := ed25519.NewKeyFromSeed(seed)
+
+	return Key{ID: id, Algorithm: EdDSA, private: private, public: private.Public().(ed25519.PublicKey)}, nil
+}
+
+// ParseKeys reads a comma separated list of kid:algorithm:secret keys,
+// the secrets are base64 encoded
+func ParseKeys(spec string) ([]Key, error) {
+	var keys []Key
+
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("key %q must be formatted as kid:algorithm:secret", entry)
+		}
+
+		secret, err := base64.StdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("key %q: secret must be base64 encoded", parts[0])
+		}
+
+		var key Key
+		switch parts[1] {
+		case HS256:
+			key, err = NewHMACKey(parts[0], secret)
+		case EdDSA:
+			key, err = NewEd25519Key(parts[0], secret)
+		default:
+			err = fmt.Errorf("key %q: unsupported algorithm %q", parts[0], parts[1])
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (k Key) sign(input []byte) []byte {
+	if k.Algorithm == EdDSA {
+		return ed25519.Sign(k.private, input)
+	}
+
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(input)
+
+	return mac.Sum(nil)
+}
+
+func (k Key) verify(input, signature []byte) bool {
+	if k.Algorithm == EdDSA {
+		return ed25519.Verify(k.public, input, signature)
+	}
+
+	return hmac.Equal(k.sign(input), signature)
+}
+
+// Keyring signs with its first key and verifies with any of them, so keys
+// can be rotated by putting the new one first and dropping the old one
+// once the tokens it signed have expired
+type Keyring struct {
+	signing Key
+	keys    map[string]Key
+}
+
+func NewKeyring(keys ...Key) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one signing key is required")
+	}
+
+	ring := &Keyring{signing: keys[0], keys: make(map[string]Key)}
+
+	for _, key := range keys {
+		if _, ok := ring.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+
+		ring.keys[key.ID] = key
+	}
+
+	return ring, nil
+}
+
+func (ring *Keyring) Sign(claims Claims) (string, error) {
+	h, err := json.Marshal(header{Algorithm: ring.signing.Algorithm, KeyID: ring.signing.ID, Type: "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := encode(h) + "." + encode(payload)
+	signature := ring.signing.sign([]byte(input))
+
+	return input + "." + encode(signature), nil
+}
+
+// Verify checks the signature of the token with the key named by its kid
+// header and returns its claims, unless it has expired. The algorithm is
+// taken from the key, a token can't pick another one.
+func (ring *Keyring) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var h header
+	if err := decode(parts[0], &h); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	key, ok := ring.keys[h.KeyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || h.Algorithm != key.Algorithm {
+		return nil, ErrInvalidToken
+	}
+
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := decode(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+
+	return &claims, nil
+}
+
+// LooksLike reports whether text has the shape of a JWT, opaque tokens
+// never contain a dot
+func LooksLike(text string) bool {
+	return strings.Count(text, ".") == 2
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string, v any) error {
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(js, v)
+}
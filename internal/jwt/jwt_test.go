@@ -0,0 +1,199 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func hmacKey(t *testing.T, id string) Key {
+	t.Helper()
+
+	key, err := NewHMACKey(id, bytes.Repeat([]byte(id[:1]), minSecretBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func edKey(t *testing.T, id string) Key {
+	t.Helper()
+
+	key, err := NewEd25519Key(id, bytes.Repeat([]byte(id[:1]), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func keyring(t *testing.T, keys ...Key) *Keyring {
+	t.Helper()
+
+	ring, err := NewKeyring(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ring
+}
+
+func claims(ttl time.Duration) Claims {
+	now := time.Now()
+
+	return Claims{
+		Subject:     "42",
+		SessionID:   7,
+		ClientID:    3,
+		Activated:   true,
+		Permissions: []string{"movies:read"},
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   now.Add(ttl).Unix(),
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	for _, key := range []Key{hmacKey(t, "h1"), edKey(t, "e1")} {
+		t.Run(key.Algorithm, func(t *testing.T) {
+			ring := keyring(t, key)
+			want := claims(time.Minute)
+
+			token, err := ring.Sign(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !LooksLike(token) {
+				t.Errorf("%q doesn't look like a JWT", token)
+			}
+
+			got, err := ring.Verify(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(*got, want) {
+				t.Errorf("got %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestVerifyLooksUpKeyID(t *testing.T) {
+	old, current := hmacKey(t, "old"), edKey(t, "new")
+
+	token, err := keyring(t, old).Sign(claims(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// after a rotation the old key only verifies
+	if _, err := keyring(t, current, old).Verify(token); err != nil {
+		t.Errorf("token of the old key rejected: %v", err)
+	}
+
+	if _, err := keyring(t, current).Verify(token); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("got %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestVerifyRejectsAlgorithmMismatch(t *testing.T) {
+	ed := edKey(t, "k1")
+
+	// a HS256 token keyed with the public key, named after the EdDSA key
+	forged, err := NewHMACKey("k1", ed.public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := keyring(t, forged).Sign(claims(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := keyring(t, ed).Verify(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("got %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestVerifyRejectsTamperedToken(t *testing.T) {
+	ring := keyring(t, hmacKey(t, "h1"))
+
+	token, err := ring.Sign(claims(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(token, ".")
+	payload := claims(time.Minute)
+	payload.Permissions = append(payload.Permissions, "movies:write")
+
+	tampered, err := keyring(t, hmacKey(t, "x1")).Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts[1] = strings.Split(tampered, ".")[1]
+
+	tests := map[string]string{
+		"payload":   strings.Join(parts, "."),
+		"malformed": "not.a.token",
+		"two parts": parts[0] + "." + parts[1],
+	}
+
+	for name, token := range tests {
+		if _, err := ring.Verify(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: got %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
+
+func TestVerifyRejectsExpiredToken(t *testing.T) {
+	ring := keyring(t, edKey(t, "e1"))
+
+	token, err := ring.Sign(claims(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ring.Verify(token); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("got %v, want ErrExpiredToken", err)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	secret := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("s"), 32))
+	short := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("s"), 31))
+
+	keys, err := ParseKeys("new:EdDSA:" + secret + ", old:HS256:" + secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 2 || keys[0].ID != "new" || keys[0].Algorithm != EdDSA || keys[1].ID != "old" || keys[1].Algorithm != HS256 {
+		t.Errorf("got %+v", keys)
+	}
+
+	for _, spec := range []string{
+		"",
+		"k1:HS256",
+		":HS256:" + secret,
+		"k1:HS256:not base64!",
+		"k1:HS256:" + short,
+		"k1:EdDSA:" + short,
+		"k1:RS256:" + secret,
+	} {
+		if _, err := ParseKeys(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+
+	if _, err := NewKeyring(hmacKey(t, "k1"), edKey(t, "k1")); err == nil {
+		t.Error("expected an error for duplicate key ids")
+	}
+}
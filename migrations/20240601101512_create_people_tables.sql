@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS people (
+  id bigserial PRIMARY KEY,
+
+  name text NOT NULL,
+  biography text NOT NULL DEFAULT '',
+
+  version integer NOT NULL DEFAULT 1,
+
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS movie_credits (
+  id bigserial PRIMARY KEY,
+
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  person_id bigint NOT NULL REFERENCES people ON DELETE CASCADE,
+
+  role text NOT NULL,
+  character text NOT NULL DEFAULT '',
+  billing_order integer NOT NULL DEFAULT 0,
+
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT movie_credits_role_check CHECK (role IN ('director', 'writer', 'actor')),
+  CONSTRAINT movie_credits_billing_order_check CHECK (billing_order >= 0),
+  CONSTRAINT movie_credits_unique_key UNIQUE (movie_id, person_id, role, character)
+);
+
+CREATE INDEX IF NOT EXISTS idx_movie_credits_person_id ON movie_credits (person_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS movie_credits;
+DROP TABLE IF EXISTS people;
+
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS reviews (
+  id bigserial PRIMARY KEY,
+
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+
+  score integer NOT NULL,
+  body text NOT NULL DEFAULT '',
+
+  version integer NOT NULL DEFAULT 1,
+
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT reviews_score_check CHECK (score BETWEEN 1 AND 10),
+  CONSTRAINT reviews_user_movie_key UNIQUE (user_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reviews_movie_id ON reviews (movie_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS reviews;
+
+-- +goose StatementEnd
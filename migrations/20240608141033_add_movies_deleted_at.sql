@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS idx_movies_deleted_at ON movies (deleted_at) WHERE deleted_at IS NOT NULL;
+
+INSERT INTO permissions (code) VALUES ('movies:admin');
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DELETE FROM permissions WHERE code = 'movies:admin';
+
+DROP INDEX IF EXISTS idx_movies_deleted_at;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS deleted_at;
+
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_movies_title_trgm ON movies USING GIN (title gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS idx_movies_title_english ON movies USING GIN (to_tsvector('english', title));
+CREATE INDEX IF NOT EXISTS idx_movies_title_french ON movies USING GIN (to_tsvector('french', title));
+CREATE INDEX IF NOT EXISTS idx_movies_title_german ON movies USING GIN (to_tsvector('german', title));
+CREATE INDEX IF NOT EXISTS idx_movies_title_spanish ON movies USING GIN (to_tsvector('spanish', title));
+CREATE INDEX IF NOT EXISTS idx_movies_title_italian ON movies USING GIN (to_tsvector('italian', title));
+CREATE INDEX IF NOT EXISTS idx_movies_title_portuguese ON movies USING GIN (to_tsvector('portuguese', title));
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS idx_movies_title_portuguese;
+DROP INDEX IF EXISTS idx_movies_title_italian;
+DROP INDEX IF EXISTS idx_movies_title_spanish;
+DROP INDEX IF EXISTS idx_movies_title_german;
+DROP INDEX IF EXISTS idx_movies_title_french;
+DROP INDEX IF EXISTS idx_movies_title_english;
+
+DROP INDEX IF EXISTS idx_movies_title_trgm;
+
+DROP EXTENSION IF EXISTS pg_trgm;
+
+-- +goose StatementEnd
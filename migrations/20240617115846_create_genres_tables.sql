@@ -0,0 +1,81 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS genres (
+  id bigserial PRIMARY KEY,
+
+  slug text NOT NULL,
+  name text NOT NULL,
+
+  version integer NOT NULL DEFAULT 1,
+
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT genres_slug_key UNIQUE (slug)
+);
+
+CREATE TABLE IF NOT EXISTS genre_aliases (
+  alias text PRIMARY KEY,
+  genre_id bigint NOT NULL REFERENCES genres ON DELETE CASCADE
+);
+
+-- seed the vocabulary from the free-text values already in use, every
+-- spelling that differs from its slug is kept as an alias
+INSERT INTO genres (slug, name)
+SELECT DISTINCT ON (slug) slug, name
+FROM (
+  SELECT trim(both '-' FROM lower(regexp_replace(trim(g.value), '[^a-zA-Z0-9]+', '-', 'g'))) AS slug, trim(g.value) AS name
+  FROM movies CROSS JOIN LATERAL unnest(movies.genres) AS g(value)
+) spellings
+WHERE slug <> ''
+ORDER BY slug, name;
+
+INSERT INTO genre_aliases (alias, genre_id)
+SELECT DISTINCT lower(trim(g.value)), genres.id
+FROM movies
+CROSS JOIN LATERAL unnest(movies.genres) AS g(value)
+INNER JOIN genres ON genres.slug = trim(both '-' FROM lower(regexp_replace(trim(g.value), '[^a-zA-Z0-9]+', '-', 'g')))
+WHERE lower(trim(g.value)) <> genres.slug
+ON CONFLICT (alias) DO NOTHING;
+
+-- the free-text values are rewritten to slugs below, the originals are
+-- kept for the down migration to restore
+CREATE TABLE IF NOT EXISTS movies_genres_backup (
+  movie_id bigint PRIMARY KEY,
+  genres text[] NOT NULL
+);
+
+INSERT INTO movies_genres_backup (movie_id, genres)
+SELECT id, genres FROM movies
+ON CONFLICT (movie_id) DO NOTHING;
+
+UPDATE movies SET genres = ARRAY(
+  SELECT deduped.slug
+  FROM (
+    SELECT DISTINCT ON (normalized.slug) normalized.slug, normalized.position
+    FROM (
+      SELECT trim(both '-' FROM lower(regexp_replace(trim(g.value), '[^a-zA-Z0-9]+', '-', 'g'))) AS slug, g.position
+      FROM unnest(movies.genres) WITH ORDINALITY AS g(value, position)
+    ) normalized
+    WHERE normalized.slug <> ''
+    ORDER BY normalized.slug, normalized.position
+  ) deduped
+  ORDER BY deduped.position
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+-- movies created since keep their slugs, edits made since to the others
+-- are lost
+UPDATE movies SET genres = movies_genres_backup.genres
+FROM movies_genres_backup
+WHERE movies.id = movies_genres_backup.movie_id;
+
+DROP TABLE IF EXISTS movies_genres_backup;
+DROP TABLE IF EXISTS genre_aliases;
+DROP TABLE IF EXISTS genres;
+
+-- +goose StatementEnd
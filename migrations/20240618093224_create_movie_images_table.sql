@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS movie_images (
+  id bigserial PRIMARY KEY,
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+
+  kind text NOT NULL,
+  format text NOT NULL,
+  width integer NOT NULL,
+  height integer NOT NULL,
+
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT movie_images_kind_check CHECK (kind IN ('poster', 'backdrop')),
+  CONSTRAINT movie_images_format_check CHECK (format IN ('jpeg', 'png'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_movie_images_movie_id ON movie_images (movie_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS movie_images;
+
+-- +goose StatementEnd
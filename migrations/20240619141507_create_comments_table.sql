@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS comments (
+  id bigserial PRIMARY KEY,
+
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  parent_id bigint REFERENCES comments ON DELETE CASCADE,
+
+  body text NOT NULL,
+
+  version integer NOT NULL DEFAULT 1,
+
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  deleted_at timestamp(0) with time zone,
+  hidden_at timestamp(0) with time zone,
+  hidden_by bigint REFERENCES users ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_comments_movie_id ON comments (movie_id, id) WHERE parent_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments (parent_id, id);
+
+INSERT INTO permissions (code) VALUES ('comments:moderate');
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DELETE FROM permissions WHERE code = 'comments:moderate';
+DROP TABLE IF EXISTS comments;
+
+-- +goose StatementEnd
@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS sessions (
+  id bigserial PRIMARY KEY,
+  family bytea NOT NULL,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+
+  ip text NOT NULL DEFAULT '',
+  user_agent text NOT NULL DEFAULT '',
+
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  last_used_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  last_used_ip text NOT NULL DEFAULT '',
+
+  CONSTRAINT sessions_family_key UNIQUE (family)
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+
+-- every token that can authenticate gets a session, the ones issued
+-- before token families existed each get a family of their own
+UPDATE tokens
+SET family = decode(md5(encode(hash, 'hex') || random()::text), 'hex')
+WHERE family IS NULL AND scope IN ('authentication', 'refresh');
+
+INSERT INTO sessions (family, user_id)
+SELECT family, min(user_id) FROM tokens WHERE family IS NOT NULL GROUP BY family;
+
+ALTER TABLE tokens
+ADD CONSTRAINT tokens_family_fkey FOREIGN KEY (family) REFERENCES sessions (family) ON DELETE CASCADE;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE tokens DROP CONSTRAINT IF EXISTS tokens_family_fkey;
+
+DROP TABLE IF EXISTS sessions;
+
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS api_keys (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+
+  name text NOT NULL,
+  prefix text NOT NULL,
+  hash bytea NOT NULL,
+  permissions text[] NOT NULL,
+
+  expiry timestamp(0) with time zone,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  last_used_at timestamp(0) with time zone,
+  last_used_ip text NOT NULL DEFAULT '',
+
+  CONSTRAINT api_keys_hash_key UNIQUE (hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys (user_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS api_keys;
+
+-- +goose StatementEnd
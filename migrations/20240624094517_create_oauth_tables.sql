@@ -0,0 +1,50 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS oauth_clients (
+  id bigserial PRIMARY KEY,
+  client_id text NOT NULL,
+  secret_hash bytea,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+
+  name text NOT NULL,
+  redirect_uris text[] NOT NULL,
+  scopes text[] NOT NULL,
+
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT oauth_clients_client_id_key UNIQUE (client_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_clients_user_id ON oauth_clients (user_id);
+
+CREATE TABLE IF NOT EXISTS oauth_codes (
+  hash bytea PRIMARY KEY,
+  client_id bigint NOT NULL REFERENCES oauth_clients ON DELETE CASCADE,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+
+  redirect_uri text NOT NULL,
+  redirect_uri_explicit boolean NOT NULL DEFAULT false,
+  scopes text[] NOT NULL,
+  code_challenge text NOT NULL,
+
+  expiry timestamp(0) with time zone NOT NULL
+);
+
+-- sessions started by a client only hold the scopes the user consented
+-- to, first party sessions have no client and no scopes
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS client_id bigint REFERENCES oauth_clients ON DELETE CASCADE;
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS scopes text[];
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE sessions DROP COLUMN IF EXISTS scopes;
+ALTER TABLE sessions DROP COLUMN IF EXISTS client_id;
+
+DROP TABLE IF EXISTS oauth_codes;
+DROP TABLE IF EXISTS oauth_clients;
+
+-- +goose StatementEnd
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+
+INSERT INTO permissions (code) VALUES ('watchlist:read'), ('watchlist:write');
+
+-- movies:read used to guard the watchlist and the watch history,
+-- whoever held it keeps access to them
+INSERT INTO users_permissions
+SELECT users_permissions.user_id, granted.id
+FROM users_permissions
+INNER JOIN permissions ON permissions.id = users_permissions.permission_id
+CROSS JOIN permissions AS granted
+WHERE permissions.code = 'movies:read' AND granted.code IN ('watchlist:read', 'watchlist:write')
+ON CONFLICT DO NOTHING;
+
+UPDATE api_keys SET permissions = permissions || ARRAY['watchlist:read', 'watchlist:write']
+WHERE 'movies:read' = ANY(permissions);
+
+UPDATE oauth_clients SET scopes = scopes || ARRAY['watchlist:read', 'watchlist:write']
+WHERE 'movies:read' = ANY(scopes);
+
+UPDATE sessions SET scopes = scopes || ARRAY['watchlist:read', 'watchlist:write']
+WHERE 'movies:read' = ANY(scopes);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+UPDATE sessions SET scopes = ARRAY(SELECT unnest(scopes) EXCEPT SELECT unnest(ARRAY['watchlist:read', 'watchlist:write']))
+WHERE scopes && ARRAY['watchlist:read', 'watchlist:write'];
+
+UPDATE oauth_clients SET scopes = ARRAY(SELECT unnest(scopes) EXCEPT SELECT unnest(ARRAY['watchlist:read', 'watchlist:write']))
+WHERE scopes && ARRAY['watchlist:read', 'watchlist:write'];
+
+UPDATE api_keys SET permissions = ARRAY(SELECT unnest(permissions) EXCEPT SELECT unnest(ARRAY['watchlist:read', 'watchlist:write']))
+WHERE permissions && ARRAY['watchlist:read', 'watchlist:write'];
+
+DELETE FROM permissions WHERE code IN ('watchlist:read', 'watchlist:write');
+
+-- +goose StatementEnd
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+
+INSERT INTO permissions (code) VALUES ('comments:write');
+
+-- movies:read used to guard writing comments,
+-- whoever held it keeps access to it
+INSERT INTO users_permissions
+SELECT users_permissions.user_id, granted.id
+FROM users_permissions
+INNER JOIN permissions ON permissions.id = users_permissions.permission_id
+CROSS JOIN permissions AS granted
+WHERE permissions.code = 'movies:read' AND granted.code IN ('comments:write')
+ON CONFLICT DO NOTHING;
+
+UPDATE api_keys SET permissions = permissions || ARRAY['comments:write']
+WHERE 'movies:read' = ANY(permissions);
+
+UPDATE oauth_clients SET scopes = scopes || ARRAY['comments:write']
+WHERE 'movies:read' = ANY(scopes);
+
+UPDATE sessions SET scopes = scopes || ARRAY['comments:write']
+WHERE 'movies:read' = ANY(scopes);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+UPDATE sessions SET scopes = ARRAY(SELECT unnest(scopes) EXCEPT SELECT unnest(ARRAY['comments:write']))
+WHERE scopes && ARRAY['comments:write'];
+
+UPDATE oauth_clients SET scopes = ARRAY(SELECT unnest(scopes) EXCEPT SELECT unnest(ARRAY['comments:write']))
+WHERE scopes && ARRAY['comments:write'];
+
+UPDATE api_keys SET permissions = ARRAY(SELECT unnest(permissions) EXCEPT SELECT unnest(ARRAY['comments:write']))
+WHERE permissions && ARRAY['comments:write'];
+
+DELETE FROM permissions WHERE code IN ('comments:write');
+
+-- +goose StatementEnd